@@ -1,23 +1,32 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"go-ngsc-erp/erp"
 	"go-ngsc-erp/erp/attendance"
+	"go-ngsc-erp/erp/employee"
 	"go-ngsc-erp/erp/login"
-	"log"
 	"math/rand"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go-ngsc-erp/internal/config"
 	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/metrics"
 
 	"github.com/robfig/cron/v3"
 )
 
 const customTimeFormat = "2006-01-02T15:04"
-const CsvPath = "./attendance.csv"
 const TimeLayout = time.RFC3339
 
+var CsvPath = "./attendance.csv"
+
 var DailyMorningCron = "0 0 8 * * 1-5"
 
 //var DailyMorningCron = "0 * * * * *"
@@ -26,67 +35,211 @@ var DailyEveningCron = "0 45 17 * * 1-5"
 
 //var DailyEveningCron = "0 * * * * *"
 
+// Độ trễ ngẫu nhiên tối đa (phút) khi lên lịch cho từng user sau routine sáng/chiều
+var MaxMorningDelayMinutes = 20
+var MaxEveningDelayMinutes = 40
+
+// holidays là các ngày nghỉ trong schedule.holidays (YYYY-MM-DD), không có routine sáng/chiều
+var holidays = make(map[string]bool)
+
+// settingsMu bảo vệ các cron string, độ trễ và ngày nghỉ ở trên khi được đổi lúc đang chạy (POST /cron, reload)
+var settingsMu sync.RWMutex
+
+// Entry ID của các routine hiện tại, theo tên routine
+var routineEntries = make(map[string]cron.EntryID)
+var routineMu sync.Mutex
+
+// Location là timezone của scheduler, mọi cron string đều được hiểu theo timezone này
+var Location = time.Local
+
+const (
+	StatusNotProcessed = "NOT_PROCESSED"
+	StatusSuccess      = "ATTENDANCE SUCCESS"
+	StatusFailed       = "ATTENDANCE FAILED"
+	StatusSkipped      = "ATTENDANCE SKIPPED"
+	// StatusDryRun: đã đăng nhập và dựng request chấm công nhưng không gửi (erp.dryRun hoặc erp.WithDryRun)
+	StatusDryRun = "DRY_RUN"
+	// StatusDuplicateSkipped: action đã chấm công thành công trong ngày, không chạy lại nếu không có WithForce
+	StatusDuplicateSkipped = "DUPLICATE_SKIPPED"
+	// StatusAlreadyDone: employee trên ERP đã ở trạng thái của action (ví dụ đã check in), không gửi attendance_manual
+	StatusAlreadyDone = "ATTENDANCE ALREADY DONE"
+	// StatusOutcomeUnknown: request attendance_manual có thể đã tới ERP nhưng không nhận được kết quả (timeout, 502/504).
+	// Được coi như đã chấm công để không gửi lại và đảo trạng thái; cần kiểm tra trên ERP.
+	StatusOutcomeUnknown = "ATTENDANCE UNKNOWN"
+)
+
+// actionStates là attendance_state trên ERP sau khi action chạy xong
+var actionStates = map[string]string{
+	"CHECKIN":  employee.StateCheckedIn,
+	"CHECKOUT": employee.StateCheckedOut,
+}
+
+// loginSettleDelay là thời gian chờ giữa login và attendance
+var loginSettleDelay = 5 * time.Second
+
 var USER_STORE = sync.Map{}
 
-var CsvWriterChan = make(chan CsvAttendanceLog)
+// Kích thước buffer của hàng đợi ghi CSV
+const CsvQueueSize = 100
+
+var CsvWriterChan = make(chan CsvAttendanceLog, CsvQueueSize)
+
+var schedulerStarted atomic.Bool
+var csvWriterRunning atomic.Bool
+var csvWriterDone = make(chan struct{})
+
+// DoAction đăng nhập rồi chấm công cho một user. Mọi log của một lần chạy đều mang run_id, user và action.
+// Mỗi action chỉ chấm công thành công một lần mỗi ngày theo IdempotencyKey, trừ khi ctx có WithForce.
+// Sau khi đăng nhập, userId/argId được đối chiếu với uid/employee ID trên ERP (xem resolveIdentity).
+func DoAction(ctx context.Context, action string, credentials UserCredentials) CsvAttendanceLog {
+	runID := elog.NewID()
+	logger := elog.FromContext(ctx).With(elog.Fields{"run_id": runID, "user": credentials.Username, "action": action, "instance": credentials.InstanceName(), elog.OverridePackage: "app"})
+	ctx = elog.NewContext(login.WithTOTPSecret(erp.WithInstance(ctx, credentials.Instance), credentials.TOTPSecret), logger)
 
-func DoAction(action string, credentials UserCredentials) {
 	csvLog := CsvAttendanceLog{
 		Username:    credentials.Username,
 		Action:      action,
 		ActionTime:  time.Now(),
 		ErrorDetail: "",
-		Status:      "NOT_PROCESSED",
+		Status:      StatusNotProcessed,
+		RunID:       runID,
 	}
-	err := login.DoLogin(credentials.Username, credentials.Password)
+	if _, err := erp.LookupInstance(credentials.Instance); err != nil {
+		logger.Error("user is bound to an unknown erp instance", elog.F("err", err))
+		metrics.AttendanceAttempts.WithLabelValues(credentials.Username, action, metrics.OutcomeFailure).Inc()
+		csvLog.ErrorDetail = "INSTANCE ERROR: " + err.Error()
+		csvLog.Status = StatusFailed
+		CsvWriterChan <- csvLog
+		return csvLog
+	}
+	if state, suppressed := credentialsSuppressed(credentials); suppressed {
+		logger.Warn("action skipped, credentials were rejected", elog.Fields{"status": state.Status, "checked_at": state.CheckedAt})
+		metrics.AttendanceAttempts.WithLabelValues(credentials.Username, action, metrics.OutcomeSkipped).Inc()
+		csvLog.ErrorDetail = state.Status + ": " + state.Error
+		csvLog.Status = StatusSkipped
+		CsvWriterChan <- csvLog
+		return csvLog
+	}
+	csvLog.IdempotencyKey = IdempotencyKey(credentials.Username, action, csvLog.ActionTime)
+	finish, reserved := reserveAction(ctx, csvLog.IdempotencyKey)
+	if !reserved {
+		logger.Warn("duplicate action skipped", elog.F("idempotency_key", csvLog.IdempotencyKey))
+		csvLog.Status = StatusDuplicateSkipped
+		csvLog.ErrorDetail = "already done today: " + csvLog.IdempotencyKey
+		CsvWriterChan <- csvLog
+		return csvLog
+	}
+	defer func() { finish(csvLog.Status) }()
+
+	err := login.DoLogin(ctx, credentials.Username, credentials.Password)
+	recordLoginResult(ctx, credentials, err)
 	if err != nil {
-		elog.Error("Error when do login", elog.Fields{"user": credentials.Username, "err": err})
+		logger.Error("Error when do login", elog.Fields{"user": credentials.Username, "err": err})
+		metrics.AttendanceAttempts.WithLabelValues(credentials.Username, action, metrics.OutcomeFailure).Inc()
 		csvLog.ErrorDetail = "LOGIN ERROR: " + err.Error()
-		csvLog.Status = "ATTENDANCE FAILED"
+		csvLog.Status = StatusFailed
 		CsvWriterChan <- csvLog
-		return
+		return csvLog
+	}
+	credentials = resolveIdentity(ctx, credentials)
+	// attendance_manual đảo trạng thái: không gửi nếu ERP đã ở trạng thái của action, kể cả khi CSV và
+	// idempotency key của instance này không biết action đã chạy (restart, leader mới, người dùng tự chấm công)
+	state, err := employee.AttendanceState(ctx, credentials.Username, credentials.ArgId)
+	if err != nil {
+		logger.Error("Error when read attendance state", elog.Fields{"user": credentials.Username, "err": err})
+		metrics.AttendanceAttempts.WithLabelValues(credentials.Username, action, metrics.OutcomeFailure).Inc()
+		csvLog.ErrorDetail = "ATTENDANCE STATE ERROR: " + err.Error()
+		csvLog.Status = StatusFailed
+		CsvWriterChan <- csvLog
+		return csvLog
 	}
-	time.Sleep(5 * time.Second) // Thời gian chờ giữa login và attendance
-	err = attendance.DoAttendance(credentials.Username, credentials.UserId, credentials.ArgId)
+	if state == actionStates[action] {
+		logger.Info("employee is already in the action state, skipping attendance", elog.F("state", state))
+		metrics.AttendanceAttempts.WithLabelValues(credentials.Username, action, metrics.OutcomeSkipped).Inc()
+		csvLog.ErrorDetail = "erp state is already " + state
+		csvLog.Status = StatusAlreadyDone
+		CsvWriterChan <- csvLog
+		return csvLog
+	}
+	time.Sleep(loginSettleDelay)
+	err = attendance.DoAttendance(ctx, credentials.Username, credentials.UserId, credentials.ArgId)
 	if err != nil {
-		elog.Error("Error when do attendance", elog.Fields{"user": credentials.Username, "err": err})
+		logger.Error("Error when do attendance", elog.Fields{"user": credentials.Username, "err": err})
+		metrics.AttendanceAttempts.WithLabelValues(credentials.Username, action, metrics.OutcomeFailure).Inc()
 		csvLog.ErrorDetail = "ATTENDANCE ERROR: " + err.Error()
-		csvLog.Status = "ATTENDANCE FAILED"
+		csvLog.Status = StatusFailed
+		if errors.Is(err, attendance.ErrOutcomeUnknown) {
+			csvLog.Status = StatusOutcomeUnknown
+		}
 		CsvWriterChan <- csvLog
-		return
+		return csvLog
+	}
+
+	if erp.DryRun(ctx) {
+		csvLog.Status = StatusDryRun
+		metrics.AttendanceAttempts.WithLabelValues(credentials.Username, action, metrics.OutcomeDryRun).Inc()
+		CsvWriterChan <- csvLog
+		return csvLog
 	}
 
-	csvLog.Status = "ATTENDANCE SUCCESS"
+	csvLog.Status = StatusSuccess
+	metrics.AttendanceAttempts.WithLabelValues(credentials.Username, action, metrics.OutcomeSuccess).Inc()
 	CsvWriterChan <- csvLog
+	return csvLog
+}
+
+// UserCount trả về số user trong USER_STORE
+func UserCount() int {
+	count := 0
+	USER_STORE.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
 }
 
 func WaitForWritingLog() {
-	csvWriter, err := NewSyncCSVWriter(CsvPath, []string{"Username", "Action", "ActionTime", "ErrorDetail", "Status"})
+	defer close(csvWriterDone)
+	csvWriter, err := NewSyncCSVWriter(CsvPath, CsvHeader)
 	if err != nil {
 		elog.Error("Error when create csv writer", elog.F("err", err))
 		return
 	}
+	csvWriterRunning.Store(true)
+	defer csvWriterRunning.Store(false)
 	for logItem := range CsvWriterChan {
-		writeErr := csvWriter.WriteRow([]string{
-			logItem.Username,
-			logItem.Action,
-			logItem.ActionTime.Format(time.RFC3339),
-			logItem.ErrorDetail,
-			logItem.Status,
-		})
+		writeErr := csvWriter.WriteRow(logItem.Record())
 		if writeErr != nil {
-			elog.Warn("Error when write log", elog.F("err", writeErr))
+			elog.Warn("Error when write log", elog.Fields{"err": writeErr, "run_id": logItem.RunID, "user": logItem.Username, "action": logItem.Action})
+			continue
 		}
+		elog.Debug("attendance log written", elog.Fields{"run_id": logItem.RunID, "user": logItem.Username, "action": logItem.Action, "status": logItem.Status})
 	}
+}
+
+// StopLogWriter đóng hàng đợi ghi CSV và chờ WaitForWritingLog ghi xong các log còn lại
+func StopLogWriter() {
 	close(CsvWriterChan)
+	<-csvWriterDone
 }
 
+// OneTimeJob chấm công một lần cho user. Credentials được đọc lại từ USER_STORE lúc chạy để mật khẩu
+// đổi sau khi lên lịch (portal, PUT credentials, reload) có hiệu lực ngay trong ngày.
 type OneTimeJob struct {
-	Cron        *cron.Cron // Tham chiếu đến scheduler để gọi Remove
-	ID          cron.EntryID
-	Username    string
-	Credentials UserCredentials
-	ActionType  string
+	Cron       *cron.Cron // Tham chiếu đến scheduler để gọi Remove
+	ID         cron.EntryID
+	Username   string
+	ActionType string
+	state      jobState
+}
+
+// credentials trả về credentials hiện tại của user, false nếu user đã bị xóa
+func (j *OneTimeJob) credentials() (UserCredentials, bool) {
+	v, ok := USER_STORE.Load(j.Username)
+	if !ok {
+		return UserCredentials{}, false
+	}
+	return v.(UserCredentials), true
 }
 
 func printNextRunTime(cronString string) {
@@ -95,8 +248,7 @@ func printNextRunTime(cronString string) {
 	// Nếu chuỗi của bạn có giây (6 trường), bạn cần dùng:
 	// parser := cron.NewParser(cron.StandardSecondsSpec)
 	// schedule, err := parser.Parse(cronString)
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(cronString)
+	schedule, err := config.CronParser.Parse(cronString)
 
 	if err != nil {
 		// Trả về lỗi nếu chuỗi cron không hợp lệ (ví dụ: quá ít hoặc quá nhiều trường).
@@ -106,7 +258,7 @@ func printNextRunTime(cronString string) {
 
 	// 2. Lấy thời điểm hiện tại.
 	// Phương thức Next sẽ tính thời điểm chạy tiếp theo SAU thời điểm này.
-	now := time.Now()
+	now := time.Now().In(Location)
 
 	// 3. Tính toán thời gian chạy tiếp theo.
 	nextRunTime := schedule.Next(now)
@@ -116,97 +268,358 @@ func printNextRunTime(cronString string) {
 }
 
 func (j *OneTimeJob) Run() {
+	j.run(context.Background())
+}
+
+func (j *OneTimeJob) run(ctx context.Context) {
+	if !j.state.start() {
+		elog.Warn("job already started", elog.Fields{"entry_id": j.ID, "user": j.Username})
+		return
+	}
 	defer func() {
 		elog.Info("removing job entry", elog.Fields{"entry_id": j.ID, "user": j.Username})
 		j.Cron.Remove(j.ID)
 	}()
 
+	metrics.PendingJobs.Dec()
+	credentials, ok := j.credentials()
+	if !ok || credentials.Paused {
+		reason := "PAUSED"
+		if !ok {
+			reason = "USER REMOVED"
+		}
+		elog.Info("skipping job", elog.Fields{"action": j.ActionType, "user": j.Username, "reason": reason})
+		CsvWriterChan <- CsvAttendanceLog{
+			Username:    j.Username,
+			Action:      j.ActionType,
+			ActionTime:  time.Now(),
+			ErrorDetail: reason,
+			Status:      StatusSkipped,
+		}
+		return
+	}
 	elog.Info("start job", elog.Fields{"action": j.ActionType, "user": j.Username})
-	DoAction(j.ActionType, j.Credentials)
+	result, err := EnqueueAction(ctx, j.ActionType, credentials)
+	if err != nil {
+		elog.Error("could not queue action", elog.Fields{"action": j.ActionType, "user": j.Username, "err": err})
+		CsvWriterChan <- CsvAttendanceLog{
+			Username:    j.Username,
+			Action:      j.ActionType,
+			ActionTime:  time.Now(),
+			ErrorDetail: "QUEUE ERROR: " + err.Error(),
+			Status:      StatusFailed,
+		}
+		return
+	}
+	<-result
+}
+
+// Configure áp dụng cấu hình lịch chạy và nơi lưu log, gọi trước RunJob
+func Configure(schedule config.ScheduleConfig, store config.StoreConfig) error {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return fmt.Errorf("could not load timezone %s: %w", schedule.Timezone, err)
+	}
+	Location = loc
+	settingsMu.Lock()
+	DailyMorningCron = schedule.DailyMorningCron
+	DailyEveningCron = schedule.DailyEveningCron
+	MaxMorningDelayMinutes = schedule.MaxMorningDelayMinutes
+	MaxEveningDelayMinutes = schedule.MaxEveningDelayMinutes
+	CredentialCheckCron = schedule.CredentialCheckCron
+	settingsMu.Unlock()
+	SetHolidays(schedule.Holidays)
+	CsvPath = store.CsvPath
+	IdempotencyFile = store.IdempotencyFile
+	return nil
+}
+
+// SetMaxDelays đổi độ trễ tối đa, áp dụng từ lần chạy routine tiếp theo
+func SetMaxDelays(morningMinutes, eveningMinutes int) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	MaxMorningDelayMinutes = morningMinutes
+	MaxEveningDelayMinutes = eveningMinutes
+}
+
+// SetHolidays thay danh sách ngày nghỉ, áp dụng từ lần chạy routine tiếp theo
+func SetHolidays(days []string) {
+	set := make(map[string]bool, len(days))
+	for _, d := range days {
+		set[d] = true
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	holidays = set
 }
 
+// isHoliday cho biết ngày của t (theo Location) có trong schedule.holidays
+func isHoliday(t time.Time) bool {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return holidays[t.In(Location).Format(config.HolidayLayout)]
+}
+
+func scheduleSettings() (morningCron, eveningCron string, morningDelay, eveningDelay int) {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return DailyMorningCron, DailyEveningCron, MaxMorningDelayMinutes, MaxEveningDelayMinutes
+}
+
+// RunJob chạy scheduler với các routine theo lịch. Không chấm công bù: instance chạy một mình (leader.backend none)
+// khởi động lại thì bỏ qua các job đã lên lịch trước đó như trước khi có bầu leader.
 func RunJob() {
+	startScheduler(false)
+}
 
-	loc, err := time.LoadLocation("Asia/Ho_Chi_Minh")
-	if err != nil {
-		elog.Fatal("could not load timezone", elog.F("err", err))
-		log.Fatal(err)
-	}
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-
-	c := cron.New(cron.WithLocation(loc), cron.WithParser(parser))
-
-	printNextRunTime(DailyMorningCron)
-	printNextRunTime(DailyEveningCron)
-
-	_, err = c.AddFunc(DailyMorningCron, func() {
-		currentTime := time.Now()
-		elog.Info("start morning routine", elog.F("ts", currentTime.Format("15:04:05")))
-		USER_STORE.Range(func(key, value interface{}) bool {
-			addTime := time.Duration(generateRandomInt(1, 20)) * time.Minute
-			newTime := currentTime.Add(addTime)
-
-			newCronn := createSpecificCronStringFromTime(newTime)
-			printNextRunTime(newCronn)
-
-			userCredential := value.(UserCredentials)
-
-			oneTimeJob := &OneTimeJob{
-				Cron:        c,
-				Username:    userCredential.Username,
-				Credentials: userCredential,
-				ActionType:  "CHECKIN",
-			}
-
-			entryID, err := c.AddJob(newCronn, oneTimeJob)
-			if err != nil {
-				elog.Error("Error adding CHECKIN Job", elog.Fields{"user": userCredential.Username, "err": err})
-			} else {
-				oneTimeJob.ID = entryID
-				elog.Info("scheduled checkin", elog.Fields{"user": userCredential.Username, "cron": newCronn, "entry_id": entryID})
-			}
-			return true
-		})
-		printNextRunTime(DailyMorningCron)
-	})
+// TakeOverJob chạy scheduler khi instance vừa nhận quyền leader và lên lịch lại các action trong ngày
+// mà leader cũ đã bỏ (catchUpRoutine)
+func TakeOverJob() {
+	startScheduler(true)
+}
+
+func startScheduler(catchUp bool) {
+	routineMu.Lock()
+	defer routineMu.Unlock()
+	if scheduler.Load() != nil {
+		return
+	}
+	c := cron.New(cron.WithLocation(Location), cron.WithParser(config.CronParser))
+	scheduler.Store(c)
+
+	addRoutineJobs(c)
+	if catchUp {
+		catchUpRoutine(c, time.Now())
+	}
+
+	c.Start()
+	schedulerStarted.Store(true)
+}
+
+// StopJob dừng scheduler khi instance mất quyền leader và chờ các job đang chạy kết thúc.
+// Các job một lần chưa đến giờ bị bỏ, leader mới lên lịch lại những action chưa chạy trong ngày (TakeOverJob).
+func StopJob() {
+	routineMu.Lock()
+	c := scheduler.Swap(nil)
+	for name := range routineEntries {
+		delete(routineEntries, name)
+	}
+	routineMu.Unlock()
+	if c == nil {
+		return
+	}
+	schedulerStarted.Store(false)
+
+	dropped := 0
+	for _, e := range c.Entries() {
+		if j, ok := e.Job.(*OneTimeJob); ok && j.state.start() {
+			metrics.PendingJobs.Dec()
+			dropped++
+		}
+	}
+	<-c.Stop().Done()
+	elog.Info("scheduler stopped", elog.F("dropped_jobs", dropped))
+}
+
+// addRoutineJobs thêm routine sáng/chiều theo cron string hiện tại và ghi nhớ entry ID để có thể thay thế
+func addRoutineJobs(c *cron.Cron) {
+	morningCron, eveningCron, _, _ := scheduleSettings()
+	printNextRunTime(morningCron)
+	printNextRunTime(eveningCron)
+
+	entryID, err := c.AddJob(morningCron, &RoutineJob{Name: RoutineMorning, Fn: func() { morningRoutine(c) }})
 	if err != nil {
 		elog.Error("Error adding Morning Routine Job", elog.F("err", err))
+	} else {
+		routineEntries[RoutineMorning] = entryID
+	}
+
+	entryID, err = c.AddJob(eveningCron, &RoutineJob{Name: RoutineEvening, Fn: func() { eveningRoutine(c) }})
+	if err != nil {
+		elog.Error("Error adding Evening Routine Job", elog.F("err", err))
+	} else {
+		routineEntries[RoutineEvening] = entryID
+	}
+	addCredentialCheckJob(c)
+}
+
+// addCredentialCheckJob thêm routine kiểm tra đăng nhập nếu CredentialCheckCron khác rỗng
+func addCredentialCheckJob(c *cron.Cron) {
+	settingsMu.RLock()
+	checkCron := CredentialCheckCron
+	settingsMu.RUnlock()
+	if checkCron == "" {
+		return
+	}
+	entryID, err := c.AddJob(checkCron, &RoutineJob{Name: RoutineCredentialCheck, Fn: checkAllCredentials})
+	if err != nil {
+		elog.Error("Error adding Credential Check Job", elog.F("err", err))
+		return
+	}
+	routineEntries[RoutineCredentialCheck] = entryID
+}
+
+// RescheduleCredentialCheck đổi lịch kiểm tra đăng nhập, chuỗi rỗng là tắt
+func RescheduleCredentialCheck(checkCron string) error {
+	if checkCron != "" {
+		if _, err := config.CronParser.Parse(checkCron); err != nil {
+			return fmt.Errorf("invalid credential check cron %q: %w", checkCron, err)
+		}
+	}
+	routineMu.Lock()
+	defer routineMu.Unlock()
+	settingsMu.Lock()
+	CredentialCheckCron = checkCron
+	settingsMu.Unlock()
+
+	c := scheduler.Load()
+	if c == nil {
+		return nil
+	}
+	if id, ok := routineEntries[RoutineCredentialCheck]; ok {
+		c.Remove(id)
+		delete(routineEntries, RoutineCredentialCheck)
+	}
+	addCredentialCheckJob(c)
+	return nil
+}
+
+// RescheduleRoutines thay cron string của routine sáng/chiều; chuỗi rỗng giữ nguyên giá trị cũ.
+// Các OneTimeJob đã lên lịch không bị ảnh hưởng.
+func RescheduleRoutines(morningCron, eveningCron string) error {
+	routineMu.Lock()
+	defer routineMu.Unlock()
+
+	currentMorning, currentEvening, _, _ := scheduleSettings()
+	if morningCron == "" {
+		morningCron = currentMorning
+	}
+	if eveningCron == "" {
+		eveningCron = currentEvening
+	}
+	if _, err := config.CronParser.Parse(morningCron); err != nil {
+		return fmt.Errorf("invalid morning cron %q: %w", morningCron, err)
+	}
+	if _, err := config.CronParser.Parse(eveningCron); err != nil {
+		return fmt.Errorf("invalid evening cron %q: %w", eveningCron, err)
+	}
+	if morningCron == currentMorning && eveningCron == currentEvening {
+		return nil
 	}
 
-	_, err = c.AddFunc(DailyEveningCron, func() {
-		currentTime := time.Now()
-		elog.Info("start evening routine", elog.F("ts", currentTime.Format("15:04:05")))
-		USER_STORE.Range(func(key, value interface{}) bool {
-			addTime := time.Duration(generateRandomInt(1, 40)) * time.Minute
-			newTime := currentTime.Add(addTime)
-			newCronn := createSpecificCronStringFromTime(newTime)
-			printNextRunTime(newCronn)
-
-			userCredential := value.(UserCredentials)
-
-			oneTimeJob := &OneTimeJob{
-				Cron:        c,
-				Username:    userCredential.Username,
-				Credentials: userCredential,
-				ActionType:  "CHECKOUT",
-			}
-
-			entryID, err := c.AddJob(newCronn, oneTimeJob)
-			if err != nil {
-				elog.Error("Error adding CHECKOUT Job", elog.Fields{"user": userCredential.Username, "err": err})
-			} else {
-				oneTimeJob.ID = entryID
-				elog.Info("scheduled checkout", elog.Fields{"user": userCredential.Username, "cron": newCronn, "entry_id": entryID})
-			}
+	settingsMu.Lock()
+	DailyMorningCron = morningCron
+	DailyEveningCron = eveningCron
+	settingsMu.Unlock()
+
+	c := scheduler.Load()
+	if c == nil {
+		return nil
+	}
+	for name, id := range routineEntries {
+		c.Remove(id)
+		delete(routineEntries, name)
+	}
+	addRoutineJobs(c)
+	elog.Info("rescheduled routines", elog.Fields{"morning": morningCron, "evening": eveningCron})
+	return nil
+}
+
+func morningRoutine(c *cron.Cron) {
+	morningCron, _, maxDelay, _ := scheduleSettings()
+	currentTime := time.Now().In(Location)
+	elog.Info("start morning routine", elog.F("ts", currentTime.Format("15:04:05")))
+	if isHoliday(currentTime) {
+		elog.Info("not scheduling, today is a holiday", elog.F("date", currentTime.Format(config.HolidayLayout)))
+		printNextRunTime(morningCron)
+		return
+	}
+	USER_STORE.Range(func(key, value interface{}) bool {
+		if value.(UserCredentials).Paused {
+			elog.Info("not scheduling, user is paused", elog.F("user", key))
+			return true
+		}
+		if state, suppressed := credentialsSuppressed(value.(UserCredentials)); suppressed {
+			elog.Warn("not scheduling, credentials were rejected", elog.Fields{"user": key, "status": state.Status})
+			return true
+		}
+		addTime := time.Duration(generateRandomInt(1, maxDelay)) * time.Minute
+		scheduleOneTimeJob(c, value.(UserCredentials), "CHECKIN", currentTime.Add(addTime))
+		return true
+	})
+	printNextRunTime(morningCron)
+}
+
+func eveningRoutine(c *cron.Cron) {
+	_, eveningCron, _, maxDelay := scheduleSettings()
+	currentTime := time.Now().In(Location)
+	elog.Info("start evening routine", elog.F("ts", currentTime.Format("15:04:05")))
+	if isHoliday(currentTime) {
+		elog.Info("not scheduling, today is a holiday", elog.F("date", currentTime.Format(config.HolidayLayout)))
+		printNextRunTime(eveningCron)
+		return
+	}
+	USER_STORE.Range(func(key, value interface{}) bool {
+		if value.(UserCredentials).Paused {
+			elog.Info("not scheduling, user is paused", elog.F("user", key))
+			return true
+		}
+		if state, suppressed := credentialsSuppressed(value.(UserCredentials)); suppressed {
+			elog.Warn("not scheduling, credentials were rejected", elog.Fields{"user": key, "status": state.Status})
 			return true
-		})
-		printNextRunTime(DailyEveningCron)
+		}
+		addTime := time.Duration(generateRandomInt(1, maxDelay)) * time.Minute
+		scheduleOneTimeJob(c, value.(UserCredentials), "CHECKOUT", currentTime.Add(addTime))
+		return true
 	})
+	scheduleDigest(c, Location, currentTime, maxDelay)
+	printNextRunTime(eveningCron)
+}
+
+// scheduleOneTimeJob thêm job chấm công một lần cho user, chạy lúc runAt
+func scheduleOneTimeJob(c *cron.Cron, userCredential UserCredentials, action string, runAt time.Time) {
+	newCronn := createSpecificCronStringFromTime(runAt)
+	printNextRunTime(newCronn)
+
+	oneTimeJob := &OneTimeJob{
+		Cron:       c,
+		Username:   userCredential.Username,
+		ActionType: action,
+	}
+
+	entryID, err := c.AddJob(newCronn, oneTimeJob)
 	if err != nil {
-		elog.Error("Error adding Evening Routine Job", elog.F("err", err))
+		elog.Error("Error adding "+action+" Job", elog.Fields{"user": userCredential.Username, "err": err})
+		return
+	}
+	oneTimeJob.ID = entryID
+	metrics.PendingJobs.Inc()
+	elog.Info("scheduled "+strings.ToLower(action), elog.Fields{"user": userCredential.Username, "cron": newCronn, "entry_id": entryID})
+}
+
+// SchedulerStarted cho biết cron scheduler đã được Start hay chưa
+func SchedulerStarted() bool {
+	return schedulerStarted.Load()
+}
+
+// CheckCsvWriter kiểm tra goroutine ghi CSV còn chạy và hàng đợi chưa bị đầy
+func CheckCsvWriter() error {
+	if !csvWriterRunning.Load() {
+		return fmt.Errorf("csv writer is not running")
+	}
+	if len(CsvWriterChan) >= cap(CsvWriterChan) {
+		return fmt.Errorf("csv writer queue is full: %d items", len(CsvWriterChan))
 	}
+	return nil
+}
 
-	c.Start()
+// CheckStoreWritable thử mở file CSV ở chế độ ghi
+func CheckStoreWritable() error {
+	f, err := os.OpenFile(CsvPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("csv store is not writable: %w", err)
+	}
+	return f.Close()
 }
 
 func createSpecificCronStringFromTime(t time.Time) string {
@@ -1,8 +1,11 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
+	"go-ngsc-erp/erp"
 	"go-ngsc-erp/erp/attendance"
+	"go-ngsc-erp/erp/employee"
 	"go-ngsc-erp/erp/login"
 	"testing"
 )
@@ -38,7 +41,7 @@ func TestLoginAndAttendance(t *testing.T) {
 
 		// Step 1: Login
 		t.Log("  -> Attempting Login...")
-		err := login.DoLogin(credentials.Username, credentials.Password)
+		err := login.DoLogin(context.Background(), credentials.Username, credentials.Password)
 		if err != nil {
 			t.Errorf("  [FAILED] Login error for %s: %v", credentials.Username, err)
 			return true // Tiếp tục sang user tiếp theo
@@ -47,7 +50,7 @@ func TestLoginAndAttendance(t *testing.T) {
 
 		// Step 2: Attendance
 		t.Log("  -> Attempting Attendance...")
-		err = attendance.DoAttendance(credentials.Username, credentials.UserId, credentials.ArgId)
+		err = attendance.DoAttendance(context.Background(), credentials.Username, credentials.UserId, credentials.ArgId)
 		if err != nil {
 			t.Errorf("  [FAILED] Attendance error for %s: %v", credentials.Username, err)
 			return true
@@ -57,3 +60,44 @@ func TestLoginAndAttendance(t *testing.T) {
 		return true
 	})
 }
+
+func TestDryRunSkipsAttendance(t *testing.T) {
+	odoo := startFakeOdoo(t, employee.StateCheckedOut)
+	useIdempotencyFile(t)
+	user := fakeOdooUser(t, "dry-run-user")
+
+	got := DoAction(erp.WithDryRun(context.Background(), true), "CHECKIN", user)
+	if got.Status != StatusDryRun {
+		t.Fatalf("per-request dry-run: got %+v, want %s", got, StatusDryRun)
+	}
+	if logged := <-CsvWriterChan; logged.Status != StatusDryRun || logged.Username != user.Username {
+		t.Errorf("csv row = %+v, want a DRY_RUN row", logged)
+	}
+
+	// erp.dryRun trong cấu hình áp dụng cho mọi action không tự đặt dry-run
+	cfg := erp.Settings()
+	cfg.DryRun = true
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := DoAction(context.Background(), "CHECKIN", user); got.Status != StatusDryRun {
+		t.Fatalf("global dry-run: got %+v, want %s", got, StatusDryRun)
+	}
+	<-CsvWriterChan
+	if n := odoo.attendance.Load(); n != 0 {
+		t.Fatalf("dry-run sent %d attendance requests, want none", n)
+	}
+
+	// Dry-run không giữ idempotency key, action thật sau đó vẫn chấm công
+	cfg.DryRun = false
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := DoAction(context.Background(), "CHECKIN", user); got.Status != StatusSuccess {
+		t.Fatalf("real action after dry-run: got %+v", got)
+	}
+	<-CsvWriterChan
+	if n := odoo.attendance.Load(); n != 1 {
+		t.Errorf("got %d attendance requests, want 1", n)
+	}
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+
+	"github.com/robfig/cron/v3"
+)
+
+// CatchUpGraceMinutes là thời gian sau khi hết khoảng độ trễ của routine mà leader mới vẫn chấm công bù
+const CatchUpGraceMinutes = 60
+
+// catchUpRoutine lên lịch lại các action của routine chạy gần nhất trong ngày mà chưa chạy cho user nào.
+// Chỉ được gọi khi nhận quyền leader (TakeOverJob): leader cũ bỏ các OneTimeJob chưa đến giờ (StopJob),
+// nên nếu chuyển leader giữa routine và giờ chạy job thì không ai chấm công trong ngày.
+// Chỉ routine gần nhất được bù để không chấm công vào sau khi routine chiều đã chạy.
+// CSV của pod mới có thể chưa có action leader cũ đã chạy; DoAction đọc attendance_state trên ERP
+// trước khi gửi nên action đã chạy rồi không bị đảo lại.
+func catchUpRoutine(c *cron.Cron, now time.Time) {
+	morningCron, eveningCron, morningDelay, eveningDelay := scheduleSettings()
+	now = now.In(Location)
+	if isHoliday(now) {
+		return
+	}
+
+	name, action, maxDelay := RoutineMorning, "CHECKIN", morningDelay
+	routineTime, ok := lastRunToday(morningCron, now)
+	if eveningTime, eveningOK := lastRunToday(eveningCron, now); eveningOK && (!ok || eveningTime.After(routineTime)) {
+		name, action, maxDelay, routineTime, ok = RoutineEvening, "CHECKOUT", eveningDelay, eveningTime, true
+	}
+	if !ok {
+		return
+	}
+	end := routineTime.Add(time.Duration(maxDelay) * time.Minute)
+	if now.After(end.Add(CatchUpGraceMinutes * time.Minute)) {
+		return
+	}
+
+	ran := actionsRunToday(action, now)
+	scheduled := 0
+	USER_STORE.Range(func(key, value interface{}) bool {
+		user := value.(UserCredentials)
+		if _, suppressed := credentialsSuppressed(user); user.Paused || suppressed || ran[user.Username] {
+			return true
+		}
+		// Giữ khoảng ngẫu nhiên trong phần còn lại của cửa sổ, hết cửa sổ thì chạy sau một phút
+		delay := 1
+		if left := int(end.Sub(now) / time.Minute); left > 1 {
+			delay = generateRandomInt(1, left)
+		}
+		scheduleOneTimeJob(c, user, action, now.Add(time.Duration(delay)*time.Minute))
+		scheduled++
+		return true
+	})
+	if name == RoutineEvening && now.Before(end) {
+		scheduleDigest(c, Location, routineTime, maxDelay)
+	}
+	elog.Info("caught up routine", elog.Fields{"routine": name, "routine_time": routineTime, "scheduled": scheduled})
+}
+
+// lastRunToday trả về lần chạy gần nhất của cron string trong ngày của now, trước now
+func lastRunToday(cronString string, now time.Time) (time.Time, bool) {
+	schedule, err := config.CronParser.Parse(cronString)
+	if err != nil {
+		return time.Time{}, false
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var last time.Time
+	for t := schedule.Next(midnight.Add(-time.Second)); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		last = t
+	}
+	return last, !last.IsZero()
+}
+
+// actionsRunToday trả về các user đã chạy action trong ngày: có dòng trong CSV (kể cả lỗi hoặc bị bỏ qua)
+// hoặc có idempotency key (trong IdempotencyFile dùng chung nếu có). Dry-run không tính là đã chạy.
+func actionsRunToday(action string, now time.Time) map[string]bool {
+	refreshActionKeys()
+	ran := make(map[string]bool)
+	day := now.In(Location).Format(time.DateOnly)
+	logs, err := ReadCSVAndMap()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		elog.Warn("could not read csv for catch up", elog.F("err", err))
+	}
+	for _, l := range logs {
+		if l.Action == action && l.Status != StatusDuplicateSkipped && l.Status != StatusDryRun && l.ActionTime.In(Location).Format(time.DateOnly) == day {
+			ran[l.Username] = true
+		}
+	}
+	USER_STORE.Range(func(key, value interface{}) bool {
+		if _, ok := actionKeys.Load(IdempotencyKey(key.(string), action, now)); ok {
+			ran[key.(string)] = true
+		}
+		return true
+	})
+	return ran
+}
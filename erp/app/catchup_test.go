@@ -0,0 +1,226 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/employee"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/config"
+)
+
+// fakeOdoo giả lập các endpoint DoAction dùng: đăng nhập jsonrpc (mật khẩu "secret"), tra employee 7300
+// của uid 7100, attendance_state và attendance_manual (đảo state). attendance đếm số lần gửi attendance_manual.
+type fakeOdoo struct {
+	state      atomic.Value
+	attendance atomic.Int32
+	// attendanceCode là HTTP status trả về cho attendance_manual sau khi đã đảo trạng thái, 0 là 200
+	attendanceCode atomic.Int32
+}
+
+func startFakeOdoo(t *testing.T, state string) *fakeOdoo {
+	f := &fakeOdoo{}
+	f.state.Store(state)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params struct {
+				Login    string `json:"login"`
+				Password string `json:"password"`
+				Kwargs   struct {
+					Fields []string `json:"fields"`
+				} `json:"kwargs"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/web/session/authenticate":
+			if req.Params.Password != "secret" {
+				_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":200,"message":"Odoo Server Error","data":{"name":"odoo.exceptions.AccessDenied","message":"Access Denied"}}}`))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "sid-7100", Path: "/", MaxAge: 3600})
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"uid":7100,"db":"ngsc"}}`))
+		case "/web/dataset/call_kw/hr.employee/search_read":
+			if strings.Join(req.Params.Kwargs.Fields, ",") == "id,attendance_state" {
+				_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[{"id":7300,"attendance_state":"` + f.state.Load().(string) + `"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[{"id":7300,"name":"Fake"}]}`))
+		case "/web/dataset/call_kw/hr.employee/attendance_manual":
+			f.attendance.Add(1)
+			next := employee.StateCheckedIn
+			if f.state.Load().(string) == employee.StateCheckedIn {
+				next = employee.StateCheckedOut
+			}
+			f.state.Store(next)
+			if code := f.attendanceCode.Load(); code != 0 {
+				w.WriteHeader(int(code))
+				return
+			}
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := config.Default().ERP
+	cfg.BaseURL = srv.URL + "/web"
+	cfg.LoginMethod = config.LoginMethodJSONRPC
+	cfg.Database = "ngsc"
+	cfg.RequestsPerSecond = 0
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	oldDelay := loginSettleDelay
+	loginSettleDelay = 0
+	t.Cleanup(func() {
+		loginSettleDelay = oldDelay
+		_ = erp.Configure(config.Default().ERP)
+	})
+	return f
+}
+
+// fakeOdooUser thêm user đăng nhập được vào fakeOdoo và xóa các trạng thái của user khi test kết thúc
+func fakeOdooUser(t *testing.T, username string) UserCredentials {
+	u := UserCredentials{Username: username, Password: "secret", UserId: 7100, ArgId: 7300}
+	USER_STORE.Store(username, u)
+	t.Cleanup(func() {
+		USER_STORE.Delete(username)
+		login.LOGIN_SESSION.Delete(username)
+		identities.Delete(username)
+		credentialStates.Delete(username)
+		for _, action := range []string{"CHECKIN", "CHECKOUT"} {
+			actionKeys.Delete(IdempotencyKey(username, action, time.Now()))
+		}
+	})
+	return u
+}
+
+// setMorningRoutine đặt routine sáng vừa chạy lúc ran, routine chiều chưa chạy hôm nay
+func setMorningRoutine(t *testing.T, ran time.Time, maxDelay int) {
+	oldMorning, oldEvening, oldMorningDelay, oldEveningDelay := scheduleSettings()
+	settingsMu.Lock()
+	DailyMorningCron = createSpecificCronStringFromTime(ran)
+	DailyEveningCron = createSpecificCronStringFromTime(ran.Add(time.Hour))
+	MaxMorningDelayMinutes = maxDelay
+	settingsMu.Unlock()
+	t.Cleanup(func() {
+		settingsMu.Lock()
+		DailyMorningCron, DailyEveningCron, MaxMorningDelayMinutes, MaxEveningDelayMinutes = oldMorning, oldEvening, oldMorningDelay, oldEveningDelay
+		settingsMu.Unlock()
+	})
+}
+
+func oneTimeJobs(t *testing.T) map[string][]string {
+	t.Helper()
+	jobs, err := ListJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make(map[string][]string)
+	for _, j := range jobs {
+		if j.Kind == JobKindOneTime && j.Username != "" {
+			actions[j.Username] = append(actions[j.Username], j.Action)
+		}
+	}
+	return actions
+}
+
+func TestCatchUpAfterFailover(t *testing.T) {
+	now := time.Now().In(Location)
+	if now.Hour() == 0 && now.Minute() < 5 {
+		t.Skip("morning routine would fall on the previous day")
+	}
+	oldPath := CsvPath
+	CsvPath = filepath.Join(t.TempDir(), "attendance.csv")
+	defer func() { CsvPath = oldPath }()
+	setMorningRoutine(t, now.Add(-2*time.Minute), 30)
+
+	for _, u := range []UserCredentials{{Username: "failover-a"}, {Username: "failover-done"}, {Username: "failover-paused", Paused: true}} {
+		USER_STORE.Store(u.Username, u)
+		defer USER_STORE.Delete(u.Username)
+	}
+	w, err := NewSyncCSVWriter(CsvPath, CsvHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := CsvAttendanceLog{Username: "failover-done", Action: "CHECKIN", ActionTime: now.Add(-time.Minute), Status: StatusSuccess}
+	if err := w.WriteRow(done.Record()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Khởi động không qua bầu leader không chấm công bù
+	RunJob()
+	defer StopJob()
+	if got := oneTimeJobs(t); len(got) != 0 {
+		t.Fatalf("jobs after a plain start = %v, want none", got)
+	}
+
+	// Nhận quyền leader: lên lịch lại các action leader cũ đã bỏ
+	StopJob()
+	TakeOverJob()
+	got := oneTimeJobs(t)
+	if len(got["failover-a"]) != 1 || got["failover-a"][0] != "CHECKIN" {
+		t.Errorf("jobs after failover = %v, want one CHECKIN for failover-a", got)
+	}
+	if len(got["failover-done"]) != 0 || len(got["failover-paused"]) != 0 {
+		t.Errorf("jobs after failover = %v, done and paused users must not be scheduled", got)
+	}
+}
+
+func TestCatchUpWithEmptyCSV(t *testing.T) {
+	now := time.Now().In(Location)
+	if now.Hour() == 0 && now.Minute() < 5 {
+		t.Skip("morning routine would fall on the previous day")
+	}
+	// Pod mới của leader có CSV rỗng: user đã được leader cũ check in, trên ERP đang checked_in
+	oldPath := CsvPath
+	CsvPath = filepath.Join(t.TempDir(), "attendance.csv")
+	defer func() { CsvPath = oldPath }()
+	setMorningRoutine(t, now.Add(-2*time.Minute), 30)
+	odoo := startFakeOdoo(t, employee.StateCheckedIn)
+	fakeOdooUser(t, "catchup-empty")
+
+	TakeOverJob()
+	defer StopJob()
+	var job *OneTimeJob
+	for _, e := range scheduler.Load().Entries() {
+		if j, ok := e.Job.(*OneTimeJob); ok && j.Username == "catchup-empty" {
+			job = j
+		}
+	}
+	if job == nil {
+		t.Fatal("catch up should schedule the user, the csv does not know it ran")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		job.run(context.Background())
+		close(done)
+	}()
+	task := <-actionQueue
+	result := DoAction(task.ctx, task.action, task.credentials)
+	task.result <- result
+	<-done
+	if result.Status != StatusAlreadyDone {
+		t.Errorf("status = %q, want %q", result.Status, StatusAlreadyDone)
+	}
+	if n := odoo.attendance.Load(); n != 0 || odoo.state.Load() != employee.StateCheckedIn {
+		t.Errorf("attendance_manual sent %d times, the user must stay checked in", n)
+	}
+	if logged := <-CsvWriterChan; logged.Status != StatusAlreadyDone {
+		t.Errorf("logged status = %q, want %q", logged.Status, StatusAlreadyDone)
+	}
+}
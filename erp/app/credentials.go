@@ -0,0 +1,263 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/notify"
+)
+
+// Trạng thái đăng nhập của một user theo lần thử gần nhất
+const (
+	CredentialValid   = "VALID"
+	CredentialInvalid = "INVALID_CREDENTIALS"
+	CredentialLocked  = "ACCOUNT_LOCKED"
+)
+
+const RoutineCredentialCheck = "CREDENTIAL_CHECK_ROUTINE"
+
+// CredentialCheckCron là lịch chạy kiểm tra đăng nhập, rỗng là tắt
+var CredentialCheckCron = "0 0 6 * * *"
+
+// credentialStates lưu CredentialState mới nhất theo username
+var credentialStates sync.Map
+
+type CredentialState struct {
+	Username  string    `json:"username"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// Suppressed: action theo lịch bị bỏ qua cho đến khi credentials được cập nhật
+	Suppressed bool `json:"suppressed"`
+	// fingerprint của credentials lúc kiểm tra, credentials đổi thì trạng thái lỗi không còn hiệu lực
+	fingerprint string
+}
+
+func credentialFingerprint(c UserCredentials) string {
+	sum := sha256.Sum256([]byte(c.Password + "\x00" + c.TOTPSecret + "\x00" + c.Instance))
+	return hex.EncodeToString(sum[:])
+}
+
+// credentialStatus phân loại lỗi đăng nhập; chuỗi rỗng là lỗi tạm thời (mạng, ERP lỗi) hoặc không kết luận được
+// (login.ErrTOTPUnsupported: mật khẩu đúng nhưng jsonrpc không làm được 2FA) nên không làm đổi trạng thái
+func credentialStatus(err error) string {
+	switch {
+	case err == nil:
+		return CredentialValid
+	case errors.Is(err, login.ErrInvalidCredentials), errors.Is(err, login.ErrTOTPRequired), errors.Is(err, login.ErrTOTPInvalid):
+		return CredentialInvalid
+	case errors.Is(err, login.ErrAccountLocked):
+		return CredentialLocked
+	}
+	return ""
+}
+
+// credentialsSuppressed cho biết action của user phải bỏ qua vì lần đăng nhập trước với đúng credentials này đã bị từ chối
+func credentialsSuppressed(c UserCredentials) (CredentialState, bool) {
+	v, ok := credentialStates.Load(c.Username)
+	if !ok {
+		return CredentialState{}, false
+	}
+	state := v.(CredentialState)
+	return state, state.Status != CredentialValid && state.fingerprint == credentialFingerprint(c)
+}
+
+// recordLoginResult cập nhật trạng thái credentials sau một lần đăng nhập (theo lịch hoặc kiểm tra định kỳ)
+// và báo cho chủ tài khoản và admin khi credentials vừa chuyển sang lỗi.
+func recordLoginResult(ctx context.Context, c UserCredentials, err error) CredentialState {
+	logger := elog.FromContext(ctx)
+	status := credentialStatus(err)
+	prev, wasSuppressed := credentialsSuppressed(c)
+	if status == "" {
+		return prev
+	}
+	state := CredentialState{
+		Username:    c.Username,
+		Status:      status,
+		CheckedAt:   time.Now(),
+		Suppressed:  status != CredentialValid,
+		fingerprint: credentialFingerprint(c),
+	}
+	if err != nil {
+		state.Error = err.Error()
+	}
+	credentialStates.Store(c.Username, state)
+
+	switch {
+	case status == CredentialValid && wasSuppressed:
+		logger.Info("credentials accepted again", elog.Fields{"user": c.Username, "previous": prev.Status})
+	case status != CredentialValid && (!wasSuppressed || prev.Status != status):
+		logger.Warn("credentials rejected, suspending scheduled actions", elog.Fields{"user": c.Username, "status": status, "err": err})
+		notifyCredentialOwner(c, state)
+	}
+	return state
+}
+
+// credentialNotices đếm các thông báo credentials đang gửi, test dùng để chờ gửi xong
+var credentialNotices sync.WaitGroup
+
+// notifyCredentialOwner báo cho chủ tài khoản qua NotifyWebhook (nếu có) và cho admin qua kênh digest.
+// Gửi trong goroutine riêng vì được gọi từ DoAction: webhook chậm không được giữ worker chấm công.
+func notifyCredentialOwner(c UserCredentials, state CredentialState) {
+	subject := fmt.Sprintf("ERP login failed for %s (%s)", c.Username, state.Status)
+	howTo := "Ask an admin to update the ERP password (PUT /users/" + c.Username + "/credentials)"
+	if CurrentConfig().Portal.Enabled {
+		howTo = "Update your ERP password on the self-service portal (/portal)"
+	}
+	ownerBody := fmt.Sprintf("Scheduled check-in/check-out for %s is paused: %s\n"+
+		"%s; scheduled actions resume after the credentials are updated.", c.Username, state.Error, howTo)
+	adminBody := fmt.Sprintf("Scheduled check-in/check-out for %s is paused: %s\n"+
+		"Update the ERP password (and TOTP secret if 2FA is on) with PUT /users/%s/credentials or POST /upload; "+
+		"scheduled actions resume after the credentials are updated.", c.Username, state.Error, c.Username)
+	if c.NotifyWebhook == "" {
+		adminBody += "\nThe owner has no notifyWebhook configured and was not notified."
+	}
+	admins := currentDigestNotifier()
+
+	credentialNotices.Add(1)
+	go func() {
+		defer credentialNotices.Done()
+		if c.NotifyWebhook != "" {
+			owner := &notify.WebhookNotifier{URL: c.NotifyWebhook, Timeout: notify.DefaultWebhookTimeout}
+			if err := owner.Notify(subject, ownerBody); err != nil {
+				elog.Error("Error sending credential notification to owner", elog.Fields{"user": c.Username, "err": err})
+			}
+		}
+		if err := admins.Notify(subject, adminBody); err != nil {
+			elog.Error("Error sending credential notification", elog.Fields{"user": c.Username, "err": err})
+		}
+	}()
+}
+
+// CheckCredentials thử đăng nhập một user ngay, kể cả khi đang bị tạm dừng
+func CheckCredentials(ctx context.Context, username string) (CredentialState, error) {
+	v, ok := USER_STORE.Load(username)
+	if !ok {
+		return CredentialState{}, ErrUserNotFound
+	}
+	c := v.(UserCredentials)
+	if _, err := erp.LookupInstance(c.Instance); err != nil {
+		return CredentialState{}, err
+	}
+	ctx = login.WithTOTPSecret(erp.WithInstance(ctx, c.Instance), c.TOTPSecret)
+	err := login.DoLogin(ctx, c.Username, c.Password)
+	state := recordLoginResult(ctx, c, err)
+	if credentialStatus(err) == "" {
+		return state, err
+	}
+	return state, nil
+}
+
+// checkAllCredentials là routine kiểm tra định kỳ: thử đăng nhập lần lượt từng user.
+// User đã bị từ chối với đúng credentials hiện tại được bỏ qua để không làm tài khoản bị khóa;
+// tài khoản bị khóa tạm thời vẫn được thử lại.
+func checkAllCredentials() {
+	logger := elog.With(elog.Fields{"routine": RoutineCredentialCheck, "run_id": elog.NewID()})
+	ctx := elog.NewContext(context.Background(), logger)
+	users := make([]UserCredentials, 0)
+	USER_STORE.Range(func(key, value interface{}) bool {
+		users = append(users, value.(UserCredentials))
+		return true
+	})
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	checked, rejected := 0, 0
+	for _, c := range users {
+		if state, suppressed := credentialsSuppressed(c); suppressed && state.Status == CredentialInvalid {
+			continue
+		}
+		if _, err := erp.LookupInstance(c.Instance); err != nil {
+			logger.Warn("skipping credential check", elog.Fields{"user": c.Username, "err": err})
+			continue
+		}
+		userCtx := login.WithTOTPSecret(erp.WithInstance(ctx, c.Instance), c.TOTPSecret)
+		err := login.DoLogin(userCtx, c.Username, c.Password)
+		checked++
+		if state := recordLoginResult(userCtx, c, err); state.Suppressed {
+			rejected++
+		}
+		if err != nil && credentialStatus(err) == "" {
+			logger.Warn("credential check inconclusive", elog.Fields{"user": c.Username, "err": err})
+		}
+	}
+	logger.Info("credential check finished", elog.Fields{"checked": checked, "rejected": rejected})
+}
+
+// UpdateCredentials đổi mật khẩu (và secret TOTP nếu khác rỗng) của user, ghi vào store.usersFile nếu có cấu hình.
+// Trạng thái INVALID_CREDENTIALS được xóa để action theo lịch chạy lại.
+func UpdateCredentials(username, password, totpSecret string) error {
+	v, ok := USER_STORE.Load(username)
+	if !ok {
+		return ErrUserNotFound
+	}
+	if password == "" {
+		return errors.New("password is required")
+	}
+	if totpSecret != "" {
+		if _, err := login.TOTPCode(totpSecret, time.Now()); err != nil {
+			return err
+		}
+	}
+	c := v.(UserCredentials)
+	c.Password = password
+	if totpSecret != "" {
+		c.TOTPSecret = totpSecret
+	}
+	if err := storeUsers(c); err != nil {
+		return err
+	}
+	credentialStates.Delete(username)
+	elog.Info("credentials updated", elog.F("user", username))
+	return nil
+}
+
+// ListCredentialStates trả về trạng thái credentials của các user đã được kiểm tra, sắp theo username
+func ListCredentialStates() []CredentialState {
+	result := make([]CredentialState, 0)
+	credentialStates.Range(func(key, value interface{}) bool {
+		state := value.(CredentialState)
+		if v, ok := USER_STORE.Load(key); ok {
+			_, state.Suppressed = credentialsSuppressed(v.(UserCredentials))
+		}
+		result = append(result, state)
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool { return result[i].Username < result[j].Username })
+	return result
+}
+
+// CredentialStateFor trả về trạng thái credentials hiện tại của một user nếu đã từng kiểm tra
+func CredentialStateFor(username string) (CredentialState, bool) {
+	v, ok := USER_STORE.Load(username)
+	if !ok {
+		return CredentialState{}, false
+	}
+	c := v.(UserCredentials)
+	state, suppressed := credentialsSuppressed(c)
+	if state.Username == "" {
+		return state, false
+	}
+	state.Suppressed = suppressed
+	return state, true
+}
+
+// SuppressedUserCount trả về số user đang bị tạm dừng vì credentials bị từ chối
+func SuppressedUserCount() int {
+	count := 0
+	USER_STORE.Range(func(key, value interface{}) bool {
+		if _, ok := credentialsSuppressed(value.(UserCredentials)); ok {
+			count++
+		}
+		return true
+	})
+	return count
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/notify"
+)
+
+type recordingNotifier struct {
+	mu       sync.Mutex
+	subjects []string
+	bodies   []string
+	// block giữ Notify cho đến khi được đóng, nil là trả về ngay
+	block chan struct{}
+}
+
+func (n *recordingNotifier) Notify(subject, body string) error {
+	if n.block != nil {
+		<-n.block
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.subjects = append(n.subjects, subject)
+	n.bodies = append(n.bodies, body)
+	return nil
+}
+
+func TestCredentialSuppression(t *testing.T) {
+	n := &recordingNotifier{}
+	SetDigestNotifier(n)
+	defer SetDigestNotifier(notify.LogNotifier{})
+	defer credentialStates.Delete("rotated")
+
+	ctx := context.Background()
+	user := UserCredentials{Username: "rotated", Password: "old"}
+	rejected := fmt.Errorf("%w: Wrong login/password", login.ErrInvalidCredentials)
+
+	recordLoginResult(ctx, user, errors.New("dial tcp: i/o timeout"))
+	if _, suppressed := credentialsSuppressed(user); suppressed {
+		t.Fatal("network errors must not suppress a user")
+	}
+
+	recordLoginResult(ctx, user, rejected)
+	state, suppressed := credentialsSuppressed(user)
+	if !suppressed || state.Status != CredentialInvalid {
+		t.Fatalf("expected INVALID_CREDENTIALS, got %+v", state)
+	}
+	recordLoginResult(ctx, user, rejected)
+	credentialNotices.Wait()
+	if len(n.subjects) != 1 {
+		t.Errorf("owner should be notified once, got %v", n.subjects)
+	}
+
+	updated := user
+	updated.Password = "new"
+	if _, suppressed := credentialsSuppressed(updated); suppressed {
+		t.Error("changed password should lift the suppression")
+	}
+	recordLoginResult(ctx, updated, nil)
+	if state, _ := credentialsSuppressed(updated); state.Status != CredentialValid {
+		t.Errorf("expected VALID after successful login, got %+v", state)
+	}
+}
+
+func TestCredentialNoticeReachesOwner(t *testing.T) {
+	admins := &recordingNotifier{block: make(chan struct{})}
+	SetDigestNotifier(admins)
+	defer SetDigestNotifier(notify.LogNotifier{})
+	defer credentialStates.Delete("owner-webhook")
+
+	owner := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		owner <- payload.Text
+	}))
+	defer srv.Close()
+
+	user := UserCredentials{Username: "owner-webhook", Password: "old", NotifyWebhook: srv.URL}
+	start := time.Now()
+	recordLoginResult(context.Background(), user, fmt.Errorf("%w: Wrong login/password", login.ErrInvalidCredentials))
+	// Kênh admin đang treo: DoAction không được chờ thông báo
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("recordLoginResult blocked for %s on the notifier", elapsed)
+	}
+	select {
+	case text := <-owner:
+		if !strings.Contains(text, "owner-webhook") {
+			t.Errorf("owner message = %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("owner webhook was not called")
+	}
+	close(admins.block)
+	credentialNotices.Wait()
+	if len(admins.subjects) != 1 || strings.Contains(admins.bodies[0], "was not notified") {
+		t.Errorf("admin notices = %v", admins.bodies)
+	}
+}
+
+func TestTOTPWithJSONRPC(t *testing.T) {
+	if status := credentialStatus(fmt.Errorf("wrapped: %w", login.ErrTOTPUnsupported)); status != "" {
+		t.Errorf("jsonrpc 2fa must be inconclusive, got %q", status)
+	}
+	cfg := config.Default().ERP
+	cfg.Instances = []config.ERPInstance{{Name: "rpc", LoginMethod: config.LoginMethodJSONRPC, Database: "ngsc"}}
+	users := []UserCredentials{{Username: "form", TOTPSecret: "JBSWY3DPEHPK3PXP"}, {Username: "rpc", Instance: "rpc", TOTPSecret: "JBSWY3DPEHPK3PXP"}}
+	err := CheckUserInstances(cfg, users)
+	if !errors.Is(err, login.ErrTOTPUnsupported) {
+		t.Fatalf("got %v, want ErrTOTPUnsupported for the jsonrpc user", err)
+	}
+	if err := CheckUserInstances(cfg, users[:1]); err != nil {
+		t.Errorf("form login with totp should be valid: %v", err)
+	}
+}
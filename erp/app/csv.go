@@ -7,6 +7,8 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"go-ngsc-erp/internal/elog"
 )
 
 // Define the structure for safe, concurrent CSV writing.
@@ -76,9 +78,9 @@ func (w *SyncCSVWriter) writeHeaderIfEmpty() error {
 		if err := w.writer.Error(); err != nil {
 			return fmt.Errorf("flush error after header write: %w", err)
 		}
-		fmt.Printf("Header written to %s.\n", w.filePath)
+		elog.Debug("csv header written", elog.F("path", w.filePath))
 	} else {
-		fmt.Printf("File %s already exists and contains data, skipping header write.\n", w.filePath)
+		elog.Debug("csv file has data, skipping header write", elog.F("path", w.filePath))
 	}
 
 	return nil
@@ -104,8 +106,13 @@ func (w *SyncCSVWriter) WriteRow(row []string) error {
 }
 
 func ReadCSVAndMap() ([]CsvAttendanceLog, error) {
+	return ReadCSVFile(CsvPath)
+}
+
+// ReadCSVFile đọc một file log chấm công bất kỳ có cùng định dạng với CsvPath
+func ReadCSVFile(path string) ([]CsvAttendanceLog, error) {
 	// 1. Mở file CSV
-	f, err := os.Open(CsvPath)
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("không thể mở file CSV: %w", err)
 	}
@@ -134,16 +141,15 @@ func ReadCSVAndMap() ([]CsvAttendanceLog, error) {
 
 		// Kiểm tra xem dòng có đủ 5 cột không
 		if len(record) < 5 {
-			fmt.Printf("Bỏ qua dòng không đủ cột: %v\n", record)
+			elog.Warn("skipping csv row with too few columns", elog.Fields{"path": path, "record": record})
 			continue
 		}
 
 		// 3. Parse chuỗi thời gian
 		actionTime, timeErr := time.Parse(TimeLayout, record[2])
-		fmt.Println(record[2])
 		if timeErr != nil {
 			// Xử lý lỗi nếu không parse được thời gian
-			fmt.Printf("Lỗi parse thời gian cho dòng %v: %v. Dùng time.Time zero value.\n", record, timeErr)
+			elog.Warn("could not parse csv action time, using zero time", elog.Fields{"path": path, "record": record, "err": timeErr})
 			actionTime = time.Time{} // Sử dụng giá trị zero nếu có lỗi
 		}
 
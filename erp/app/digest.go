@@ -0,0 +1,190 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/notify"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Thời gian chờ thêm sau độ trễ tối đa của routine chiều để các job CHECKOUT kịp ghi log
+const DigestGraceMinutes = 5
+
+// digestNotifier là kênh gửi bản tổng hợp cuối ngày, mặc định ghi qua elog
+var digestNotifier atomic.Value
+
+func init() {
+	SetDigestNotifier(notify.LogNotifier{})
+}
+
+// SetDigestNotifier đổi kênh gửi bản tổng hợp, có thể gọi khi đang chạy
+func SetDigestNotifier(n notify.Notifier) {
+	digestNotifier.Store(&n)
+}
+
+func currentDigestNotifier() notify.Notifier {
+	return *digestNotifier.Load().(*notify.Notifier)
+}
+
+var digestActions = []string{"CHECKIN", "CHECKOUT"}
+
+type DigestFailure struct {
+	Username    string `json:"username"`
+	Action      string `json:"action"`
+	ErrorDetail string `json:"errorDetail"`
+}
+
+type DailyDigest struct {
+	Date      string          `json:"date"`
+	Succeeded []string        `json:"succeeded"`
+	Failed    []DigestFailure `json:"failed"`
+	Skipped   []string        `json:"skipped"`
+	Pending   []string        `json:"pending"`
+}
+
+// DigestJob là job chạy một lần, tổng hợp log trong ngày rồi tự xóa khỏi scheduler
+type DigestJob struct {
+	Cron  *cron.Cron
+	ID    cron.EntryID
+	Loc   *time.Location
+	Day   time.Time
+	state jobState
+}
+
+func (j *DigestJob) Run() {
+	if !j.state.start() {
+		return
+	}
+	defer func() {
+		elog.Info("removing digest entry", elog.F("entry_id", j.ID))
+		j.Cron.Remove(j.ID)
+	}()
+
+	logs, err := ReadCSVAndMap()
+	if err != nil {
+		elog.Error("Error reading csv for digest", elog.F("err", err))
+		return
+	}
+	digest := BuildDailyDigest(logs, storedUsernames(), j.Day, j.Loc)
+	if err := currentDigestNotifier().Notify("Attendance digest "+digest.Date, digest.String()); err != nil {
+		elog.Error("Error sending digest", elog.F("err", err))
+		return
+	}
+	elog.Info("digest sent", elog.Fields{"date": digest.Date, "failed": len(digest.Failed), "pending": len(digest.Pending)})
+}
+
+func scheduleDigest(c *cron.Cron, loc *time.Location, eveningTime time.Time, maxEveningDelay int) {
+	runTime := eveningTime.Add(time.Duration(maxEveningDelay+DigestGraceMinutes) * time.Minute)
+	digestCron := createSpecificCronStringFromTime(runTime)
+
+	job := &DigestJob{Cron: c, Loc: loc, Day: eveningTime}
+	entryID, err := c.AddJob(digestCron, job)
+	if err != nil {
+		elog.Error("Error adding digest Job", elog.F("err", err))
+		return
+	}
+	job.ID = entryID
+	elog.Info("scheduled digest", elog.Fields{"cron": digestCron, "entry_id": entryID})
+}
+
+func storedUsernames() []string {
+	usernames := make([]string, 0)
+	USER_STORE.Range(func(key, value interface{}) bool {
+		usernames = append(usernames, key.(string))
+		return true
+	})
+	return usernames
+}
+
+// BuildDailyDigest phân loại từng user theo trạng thái mới nhất của mỗi action trong ngày.
+// User có action lỗi được xếp vào Failed, bị bỏ qua vào Skipped, chưa đủ CHECKIN/CHECKOUT vào Pending.
+// Action chỉ chạy dry-run chưa được chấm công thật nên cũng tính là Pending.
+func BuildDailyDigest(logs []CsvAttendanceLog, usernames []string, day time.Time, loc *time.Location) DailyDigest {
+	dayStr := day.In(loc).Format(time.DateOnly)
+
+	latest := make(map[string]map[string]CsvAttendanceLog)
+	for _, u := range usernames {
+		latest[u] = make(map[string]CsvAttendanceLog)
+	}
+	for _, l := range logs {
+		// Lần chạy trùng bị bỏ qua không thay đổi kết quả của action trong ngày
+		if l.ActionTime.In(loc).Format(time.DateOnly) != dayStr || l.Status == StatusDuplicateSkipped {
+			continue
+		}
+		if latest[l.Username] == nil {
+			latest[l.Username] = make(map[string]CsvAttendanceLog)
+		}
+		if prev, ok := latest[l.Username][l.Action]; !ok || !l.ActionTime.Before(prev.ActionTime) {
+			latest[l.Username][l.Action] = l
+		}
+	}
+
+	digest := DailyDigest{
+		Date:      dayStr,
+		Succeeded: make([]string, 0),
+		Failed:    make([]DigestFailure, 0),
+		Skipped:   make([]string, 0),
+		Pending:   make([]string, 0),
+	}
+	users := make([]string, 0, len(latest))
+	for u := range latest {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+
+	for _, u := range users {
+		actions := latest[u]
+		failed, skipped, pending := false, false, false
+		for _, action := range digestActions {
+			l, ok := actions[action]
+			switch {
+			case !ok || l.Status == StatusNotProcessed || l.Status == StatusDryRun:
+				pending = true
+			case l.Status == StatusFailed || l.Status == StatusOutcomeUnknown:
+				failed = true
+				digest.Failed = append(digest.Failed, DigestFailure{Username: u, Action: action, ErrorDetail: l.ErrorDetail})
+			case l.Status == StatusSkipped:
+				skipped = true
+			}
+		}
+		switch {
+		case failed:
+		case skipped:
+			digest.Skipped = append(digest.Skipped, u)
+		case pending:
+			digest.Pending = append(digest.Pending, u)
+		default:
+			digest.Succeeded = append(digest.Succeeded, u)
+		}
+	}
+	return digest
+}
+
+func (d DailyDigest) String() string {
+	var sb strings.Builder
+	writeList := func(title string, users []string) {
+		if len(users) == 0 {
+			fmt.Fprintf(&sb, "%s (0): -\n", title)
+			return
+		}
+		fmt.Fprintf(&sb, "%s (%d): %s\n", title, len(users), strings.Join(users, ", "))
+	}
+	writeList("Succeeded", d.Succeeded)
+	fmt.Fprintf(&sb, "Failed (%d):", len(d.Failed))
+	if len(d.Failed) == 0 {
+		sb.WriteString(" -")
+	}
+	sb.WriteString("\n")
+	for _, f := range d.Failed {
+		fmt.Fprintf(&sb, "  - %s %s: %s\n", f.Username, f.Action, f.ErrorDetail)
+	}
+	writeList("Skipped", d.Skipped)
+	writeList("Pending", d.Pending)
+	return sb.String()
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildDailyDigest(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		t.Fatalf("could not load timezone: %v", err)
+	}
+	day := time.Date(2025, 11, 28, 18, 30, 0, 0, loc)
+	at := func(hour, min int) time.Time {
+		return time.Date(2025, 11, 28, hour, min, 0, 0, loc)
+	}
+
+	logs := []CsvAttendanceLog{
+		{Username: "ok", Action: "CHECKIN", ActionTime: at(8, 5), Status: StatusSuccess},
+		{Username: "ok", Action: "CHECKOUT", ActionTime: at(17, 50), Status: StatusSuccess},
+		{Username: "ok", Action: "CHECKOUT", ActionTime: at(17, 58), Status: StatusDuplicateSkipped},
+		{Username: "fail", Action: "CHECKIN", ActionTime: at(8, 3), Status: StatusSuccess},
+		{Username: "fail", Action: "CHECKOUT", ActionTime: at(17, 55), Status: StatusFailed, ErrorDetail: "LOGIN ERROR: boom"},
+		// lần thử lại thành công sau đó phải ghi đè kết quả lỗi trước
+		{Username: "retried", Action: "CHECKIN", ActionTime: at(8, 1), Status: StatusFailed},
+		{Username: "retried", Action: "CHECKIN", ActionTime: at(8, 9), Status: StatusSuccess},
+		{Username: "retried", Action: "CHECKOUT", ActionTime: at(18, 0), Status: StatusSuccess},
+		{Username: "leave", Action: "CHECKIN", ActionTime: at(8, 0), Status: StatusSkipped},
+		{Username: "late", Action: "CHECKIN", ActionTime: at(8, 10), Status: StatusSuccess},
+		{Username: "dry", Action: "CHECKIN", ActionTime: at(8, 2), Status: StatusDryRun},
+		{Username: "dry", Action: "CHECKOUT", ActionTime: at(17, 46), Status: StatusDryRun},
+		// log của ngày hôm trước không được tính
+		{Username: "yesterday", Action: "CHECKOUT", ActionTime: at(17, 0).AddDate(0, 0, -1), Status: StatusFailed},
+	}
+
+	digest := BuildDailyDigest(logs, []string{"ok", "fail", "retried", "leave", "late", "dry", "idle"}, day, loc)
+
+	if digest.Date != "2025-11-28" {
+		t.Errorf("unexpected date %q", digest.Date)
+	}
+	assertUsers(t, "succeeded", digest.Succeeded, []string{"ok", "retried"})
+	assertUsers(t, "skipped", digest.Skipped, []string{"leave"})
+	assertUsers(t, "pending", digest.Pending, []string{"dry", "idle", "late"})
+	if len(digest.Failed) != 1 || digest.Failed[0].Username != "fail" || digest.Failed[0].Action != "CHECKOUT" {
+		t.Errorf("unexpected failed list %+v", digest.Failed)
+	}
+}
+
+func assertUsers(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %v, want %v", name, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			return
+		}
+	}
+}
@@ -1,12 +1,51 @@
 package app
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+)
 
 type UserCredentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	UserId   int    `json:"userId"`
 	ArgId    int    `json:"argId"`
+	// Instance là tên ERP trong erp.instances, bỏ trống là ERP mặc định
+	Instance string `json:"instance,omitempty"`
+	// TOTPSecret là secret base32 của ứng dụng xác thực, chỉ cần khi tài khoản bật 2FA trên Odoo
+	TOTPSecret string `json:"totpSecret,omitempty"`
+	// Paused tạm dừng chấm công theo lịch, action chạy tay vẫn được thực hiện
+	Paused bool `json:"paused,omitempty"`
+	// NotifyWebhook là incoming webhook của chính chủ tài khoản (tin nhắn riêng Slack, Google Chat...) nhận cảnh báo
+	// khi ERP từ chối đăng nhập. Bỏ trống thì chỉ admin được báo qua kênh digest.
+	NotifyWebhook string `json:"notifyWebhook,omitempty"`
+}
+
+// Redact ẩn mật khẩu khi UserCredentials được ghi log
+func (u UserCredentials) Redact() interface{} {
+	u.Password = elog.RedactedValue
+	if u.TOTPSecret != "" {
+		u.TOTPSecret = elog.RedactedValue
+	}
+	if u.NotifyWebhook != "" {
+		u.NotifyWebhook = elog.RedactedValue
+	}
+	return u
+}
+
+func (u UserCredentials) String() string {
+	return fmt.Sprintf("UserCredentials{username=%s, instance=%s, userId=%d, argId=%d}", u.Username, u.InstanceName(), u.UserId, u.ArgId)
+}
+
+// InstanceName trả về Instance, hoặc config.DefaultInstance nếu bỏ trống
+func (u UserCredentials) InstanceName() string {
+	if u.Instance == "" {
+		return config.DefaultInstance
+	}
+	return u.Instance
 }
 
 type CsvAttendanceLog struct {
@@ -15,4 +54,16 @@ type CsvAttendanceLog struct {
 	ActionTime  time.Time `json:"actionTime"`
 	ErrorDetail string    `json:"errorDetail"`
 	Status      string    `json:"status"`
+	// RunID chỉ dùng để nối log của một lần chạy, không ghi vào file CSV
+	RunID string `json:"runId,omitempty"`
+	// IdempotencyKey là user|action|ngày làm việc, không ghi vào file CSV
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+// CsvHeader là dòng tiêu đề của file log chấm công
+var CsvHeader = []string{"Username", "Action", "ActionTime", "ErrorDetail", "Status"}
+
+// Record trả về một dòng CSV theo thứ tự của CsvHeader
+func (l CsvAttendanceLog) Record() []string {
+	return []string{l.Username, l.Action, l.ActionTime.Format(TimeLayout), l.ErrorDetail, l.Status}
 }
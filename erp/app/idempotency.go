@@ -0,0 +1,208 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/internal/elog"
+)
+
+// Trạng thái của một idempotency key trong actionKeys
+const (
+	keyInFlight = "IN_FLIGHT"
+	keyDone     = "DONE"
+)
+
+// actionKeys lưu các action đã chấm công thành công (hoặc đang chạy) theo IdempotencyKey.
+// Được nạp một lần từ CsvPath ở lần dùng đầu tiên. Khi có IdempotencyFile, actionKeys là bản sao của file
+// và được đọc lại trước mỗi lần giữ key, để key của replica khác hoặc của lần chạy trước restart vẫn chặn action.
+var actionKeys sync.Map
+var actionKeysOnce sync.Once
+
+// IdempotencyFile là file JSON lưu idempotency key, đặt trên volume dùng chung giữa các replica; rỗng là chỉ giữ trong bộ nhớ
+var IdempotencyFile = ""
+
+// keysMu tuần tự hóa đọc-sửa-ghi actionKeys và IdempotencyFile trong instance này
+var keysMu sync.Mutex
+
+type forceKey struct{}
+
+// WithForce cho phép DoAction chạy lại action đã chấm công thành công trong ngày
+func WithForce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceKey{}, true)
+}
+
+func forced(ctx context.Context) bool {
+	v, _ := ctx.Value(forceKey{}).(bool)
+	return v
+}
+
+// IdempotencyKey định danh một action của user trong một ngày làm việc theo timezone của scheduler
+func IdempotencyKey(username, action string, t time.Time) string {
+	return username + "|" + action + "|" + t.In(Location).Format(time.DateOnly)
+}
+
+// reserveAction giữ key trước khi chạy action, trả về false nếu action đã thành công hoặc đang chạy.
+// Hàm finish trả về phải được gọi với trạng thái cuối của action. Dry-run chỉ kiểm tra key, không giữ hay sửa,
+// để không chặn lần chạy thật trong lúc dry-run và không xóa được bản ghi của lần chạy thật.
+// Key IN_FLIGHT còn lại trong IdempotencyFile khi instance chết giữa chừng cũng chặn action, như kết quả không rõ.
+func reserveAction(ctx context.Context, key string) (finish func(status string), ok bool) {
+	actionKeysOnce.Do(loadActionKeys)
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	syncActionKeys()
+	prev, loaded := actionKeys.Load(key)
+	if erp.DryRun(ctx) {
+		if loaded && !forced(ctx) {
+			return nil, false
+		}
+		return func(string) {}, true
+	}
+	if loaded && !forced(ctx) {
+		return nil, false
+	}
+	setActionKey(key, keyInFlight)
+	return func(status string) { finishAction(key, status, prev == keyDone) }, true
+}
+
+// finishAction ghi nhận kết quả: lần chấm công thật thành công, ERP đã ở trạng thái của action hoặc không rõ
+// request đã tới ERP hay chưa (StatusOutcomeUnknown) đều chặn các lần sau, vì chạy lại sẽ đảo trạng thái.
+// Lần chạy lại bằng WithForce thất bại trả key về DONE nếu action đã thành công trước đó.
+func finishAction(key string, status string, wasDone bool) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	syncActionKeys()
+	if status == StatusSuccess || status == StatusAlreadyDone || status == StatusOutcomeUnknown || wasDone {
+		setActionKey(key, keyDone)
+		return
+	}
+	if v, ok := actionKeys.Load(key); ok && v == keyInFlight {
+		setActionKey(key, "")
+	}
+}
+
+// setActionKey ghi trạng thái của key vào actionKeys và IdempotencyFile, status rỗng là xóa key.
+// Gọi khi đang giữ keysMu. Không ghi được file thì chỉ còn bản trong bộ nhớ; DoAction vẫn đọc
+// attendance_state trên ERP trước khi gửi nên action không bị đảo ngược.
+func setActionKey(key, status string) {
+	if status == "" {
+		actionKeys.Delete(key)
+	} else {
+		actionKeys.Store(key, status)
+	}
+	if IdempotencyFile == "" {
+		return
+	}
+	keys, err := readKeyFile(IdempotencyFile)
+	if err == nil {
+		if status == "" {
+			delete(keys, key)
+		} else {
+			keys[key] = status
+		}
+		err = writeKeyFile(IdempotencyFile, keys)
+	}
+	if err != nil {
+		elog.Error("could not persist idempotency key", elog.Fields{"idempotency_key": key, "err": err})
+	}
+}
+
+// syncActionKeys thay actionKeys bằng nội dung IdempotencyFile. Gọi khi đang giữ keysMu.
+func syncActionKeys() {
+	if IdempotencyFile == "" {
+		return
+	}
+	keys, err := readKeyFile(IdempotencyFile)
+	if err != nil {
+		elog.Warn("could not read idempotency file, using keys in memory", elog.F("err", err))
+		return
+	}
+	actionKeys.Range(func(k, _ interface{}) bool {
+		if _, ok := keys[k.(string)]; !ok {
+			actionKeys.Delete(k)
+		}
+		return true
+	})
+	for k, v := range keys {
+		actionKeys.Store(k, v)
+	}
+}
+
+// refreshActionKeys đọc lại IdempotencyFile để các key của replica khác có trong actionKeys
+func refreshActionKeys() {
+	actionKeysOnce.Do(loadActionKeys)
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	syncActionKeys()
+}
+
+// readKeyFile đọc IdempotencyFile, file chưa tồn tại là danh sách rỗng
+func readKeyFile(path string) (map[string]string, error) {
+	keys := make(map[string]string)
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency file %s: %w", path, err)
+	}
+	if len(raw) == 0 {
+		return keys, nil
+	}
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse idempotency file %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// writeKeyFile ghi key qua file tạm rồi rename, bỏ các key cũ hơn hôm qua để file không lớn dần
+func writeKeyFile(path string, keys map[string]string) error {
+	yesterday := time.Now().In(Location).AddDate(0, 0, -1).Format(time.DateOnly)
+	for k := range keys {
+		if day := k[strings.LastIndex(k, "|")+1:]; day < yesterday {
+			delete(keys, k)
+		}
+	}
+	raw, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency keys: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return fmt.Errorf("failed to write idempotency file %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace idempotency file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadActionKeys nạp các action đã xong trong CSV của instance này, kể cả vào IdempotencyFile
+func loadActionKeys() {
+	logs, err := ReadCSVAndMap()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			elog.Warn("could not load idempotency keys from csv", elog.F("err", err))
+		}
+		return
+	}
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	syncActionKeys()
+	for _, l := range logs {
+		if l.Status != StatusSuccess && l.Status != StatusAlreadyDone && l.Status != StatusOutcomeUnknown {
+			continue
+		}
+		key := IdempotencyKey(l.Username, l.Action, l.ActionTime)
+		if v, ok := actionKeys.Load(key); !ok || v != keyDone {
+			setActionKey(key, keyDone)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/employee"
+)
+
+// useIdempotencyFile dùng CSV và IdempotencyFile mới trong thư mục tạm
+func useIdempotencyFile(t *testing.T) string {
+	dir := t.TempDir()
+	oldPath, oldFile := CsvPath, IdempotencyFile
+	CsvPath = filepath.Join(dir, "attendance.csv")
+	IdempotencyFile = filepath.Join(dir, "idempotency.json")
+	t.Cleanup(func() { CsvPath, IdempotencyFile = oldPath, oldFile })
+	return IdempotencyFile
+}
+
+// forgetActionKeys xóa các key trong bộ nhớ, như một replica khác hoặc instance vừa restart
+func forgetActionKeys() {
+	actionKeys.Range(func(k, _ interface{}) bool {
+		actionKeys.Delete(k)
+		return true
+	})
+}
+
+func TestReserveAction(t *testing.T) {
+	oldPath := CsvPath
+	CsvPath = filepath.Join(t.TempDir(), "attendance.csv")
+	defer func() { CsvPath = oldPath }()
+
+	ctx := context.Background()
+	key := IdempotencyKey("idem", "CHECKIN", time.Now())
+	defer actionKeys.Delete(key)
+
+	reserve := func(ctx context.Context) (func(string), bool) { return reserveAction(ctx, key) }
+	finish, ok := reserve(ctx)
+	if !ok {
+		t.Fatal("first reservation should succeed")
+	}
+	if _, ok := reserve(ctx); ok {
+		t.Fatal("in-flight action must not be reserved twice")
+	}
+	finish(StatusFailed)
+	if finish, ok = reserve(ctx); !ok {
+		t.Fatal("failed action should be retryable")
+	}
+	finish(StatusSuccess)
+	if _, ok := reserve(ctx); ok {
+		t.Fatal("succeeded action must not run again")
+	}
+	if finish, ok = reserve(WithForce(ctx)); !ok {
+		t.Fatal("forced action should run")
+	}
+	finish(StatusSuccess)
+
+	// Chạy lại bằng force thất bại hoặc dry-run không được xóa bản ghi của lần thành công
+	dryRun := erp.WithDryRun(ctx, true)
+	for _, c := range []struct {
+		ctx    context.Context
+		status string
+	}{{WithForce(ctx), StatusFailed}, {WithForce(dryRun), StatusDryRun}} {
+		if finish, ok = reserve(c.ctx); !ok {
+			t.Fatal("forced action should run")
+		}
+		finish(c.status)
+		if _, ok := reserve(ctx); ok {
+			t.Fatalf("forced %s run erased the earlier success", c.status)
+		}
+	}
+	if _, ok := reserve(dryRun); ok {
+		t.Fatal("dry-run should report an action already done")
+	}
+	result := DoAction(ctx, "CHECKIN", UserCredentials{Username: "idem"})
+	if result.Status != StatusDuplicateSkipped {
+		t.Fatalf("status = %q, want %q", result.Status, StatusDuplicateSkipped)
+	}
+	if logged := <-CsvWriterChan; logged.Status != StatusDuplicateSkipped {
+		t.Fatalf("logged status = %q, want %q", logged.Status, StatusDuplicateSkipped)
+	}
+}
+
+func TestDryRunDoesNotReserve(t *testing.T) {
+	oldPath := CsvPath
+	CsvPath = filepath.Join(t.TempDir(), "attendance.csv")
+	defer func() { CsvPath = oldPath }()
+
+	ctx := context.Background()
+	key := IdempotencyKey("idem-dry", "CHECKIN", time.Now())
+	defer actionKeys.Delete(key)
+
+	finishDry, ok := reserveAction(erp.WithDryRun(ctx, true), key)
+	if !ok {
+		t.Fatal("dry-run should run")
+	}
+	// Lần chạy theo lịch trong lúc dry-run đang chạy vẫn phải được chấm công
+	finish, ok := reserveAction(erp.WithDryRun(ctx, false), key)
+	if !ok {
+		t.Fatal("a dry-run must not block the real action")
+	}
+	finishDry(StatusDryRun)
+	finish(StatusSuccess)
+	if _, ok := reserveAction(erp.WithDryRun(ctx, false), key); ok {
+		t.Fatal("succeeded action must not run again")
+	}
+}
+
+func TestIdempotencyFileSharedAcrossInstances(t *testing.T) {
+	path := useIdempotencyFile(t)
+	ctx := context.Background()
+	now := time.Now()
+	done := IdempotencyKey("shared-done", "CHECKIN", now)
+	unknown := IdempotencyKey("shared-unknown", "CHECKIN", now)
+	failed := IdempotencyKey("shared-failed", "CHECKIN", now)
+	running := IdempotencyKey("shared-running", "CHECKIN", now)
+	old := IdempotencyKey("shared-old", "CHECKIN", now.AddDate(0, 0, -3))
+	defer func() {
+		for _, k := range []string{done, unknown, failed, running, old} {
+			actionKeys.Delete(k)
+		}
+	}()
+
+	for key, status := range map[string]string{done: StatusSuccess, unknown: StatusOutcomeUnknown, failed: StatusFailed} {
+		finish, ok := reserveAction(ctx, key)
+		if !ok {
+			t.Fatalf("%s: first reservation should succeed", key)
+		}
+		finish(status)
+	}
+	// Replica khác đang chạy action, key cũ hơn hôm qua bị dọn khi ghi file
+	keys, err := readKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys[running] = keyInFlight
+	keys[old] = keyDone
+	if err := writeKeyFile(path, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	forgetActionKeys()
+	for _, key := range []string{done, unknown, running} {
+		if _, ok := reserveAction(ctx, key); ok {
+			t.Errorf("%s must stay reserved for other instances", key)
+		}
+	}
+	finish, ok := reserveAction(ctx, failed)
+	if !ok {
+		t.Fatal("failed action should be retryable")
+	}
+	finish(StatusFailed)
+	if keys, _ := readKeyFile(path); keys[failed] != "" || keys[old] != "" || keys[done] != keyDone {
+		t.Errorf("idempotency file = %v", keys)
+	}
+}
+
+func TestUnknownOutcomeIsNotRetried(t *testing.T) {
+	useIdempotencyFile(t)
+	odoo := startFakeOdoo(t, employee.StateCheckedOut)
+	// Gateway hết thời gian chờ sau khi Odoo đã chấm công
+	odoo.attendanceCode.Store(http.StatusGatewayTimeout)
+	u := fakeOdooUser(t, "unknown-outcome")
+
+	if result := DoAction(context.Background(), "CHECKIN", u); result.Status != StatusOutcomeUnknown {
+		t.Fatalf("status = %q, want %q", result.Status, StatusOutcomeUnknown)
+	}
+	<-CsvWriterChan
+	forgetActionKeys()
+	if result := DoAction(context.Background(), "CHECKIN", u); result.Status != StatusDuplicateSkipped {
+		t.Errorf("retry status = %q, want %q", result.Status, StatusDuplicateSkipped)
+	}
+	<-CsvWriterChan
+	if n := odoo.attendance.Load(); n != 1 || odoo.state.Load() != employee.StateCheckedIn {
+		t.Errorf("attendance_manual sent %d times, want 1", n)
+	}
+}
@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/employee"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/elog"
+)
+
+// Kết quả đối chiếu userId/argId đã lưu với uid/employee ID tìm được trên ERP
+const (
+	IdentityVerified = "VERIFIED"
+	IdentityFilled   = "FILLED"
+	IdentityMismatch = "MISMATCH"
+	IdentityError    = "ERROR"
+)
+
+// IdentityRecheckInterval là thời gian giữ kết quả VERIFIED/FILLED trước khi tra lại trên ERP
+var IdentityRecheckInterval = 24 * time.Hour
+
+// identities lưu IdentityStatus mới nhất theo username
+var identities sync.Map
+
+type IdentityStatus struct {
+	Username     string    `json:"username"`
+	StoredUserId int       `json:"storedUserId"`
+	StoredArgId  int       `json:"storedArgId"`
+	UID          int       `json:"uid"`
+	EmployeeID   int       `json:"employeeId"`
+	EmployeeName string    `json:"employeeName,omitempty"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	CheckedAt    time.Time `json:"checkedAt"`
+}
+
+// reconcileIdentity so sánh giá trị đã lưu với giá trị tìm được: giá trị 0 được điền, giá trị khác bị đánh dấu MISMATCH.
+// Khi lệch, credentials trả về dùng giá trị của ERP để không chấm công nhầm employee.
+func reconcileIdentity(credentials UserCredentials, found employee.Identity) (UserCredentials, IdentityStatus) {
+	status := IdentityStatus{
+		Username:     credentials.Username,
+		StoredUserId: credentials.UserId,
+		StoredArgId:  credentials.ArgId,
+		UID:          found.UID,
+		EmployeeID:   found.EmployeeID,
+		EmployeeName: found.EmployeeName,
+		Status:       IdentityVerified,
+		CheckedAt:    time.Now(),
+	}
+	if (credentials.UserId != 0 && credentials.UserId != found.UID) || (credentials.ArgId != 0 && credentials.ArgId != found.EmployeeID) {
+		status.Status = IdentityMismatch
+	} else if credentials.UserId == 0 || credentials.ArgId == 0 {
+		status.Status = IdentityFilled
+	}
+	credentials.UserId = found.UID
+	credentials.ArgId = found.EmployeeID
+	return credentials, status
+}
+
+// resolveIdentity tra uid/employee ID sau khi đăng nhập và trả về credentials dùng để chấm công.
+// Kết quả VERIFIED/FILLED được dùng lại trong IdentityRecheckInterval; nếu tra cứu lỗi thì giữ nguyên giá trị đã lưu.
+func resolveIdentity(ctx context.Context, credentials UserCredentials) UserCredentials {
+	if v, ok := identities.Load(credentials.Username); ok {
+		prev := v.(IdentityStatus)
+		if (prev.Status == IdentityVerified || prev.Status == IdentityFilled) &&
+			prev.UID == credentials.UserId && prev.EmployeeID == credentials.ArgId &&
+			time.Since(prev.CheckedAt) < IdentityRecheckInterval {
+			return credentials
+		}
+	}
+	resolved, _ := discoverIdentity(ctx, credentials)
+	return resolved
+}
+
+func discoverIdentity(ctx context.Context, credentials UserCredentials) (UserCredentials, IdentityStatus) {
+	logger := elog.FromContext(ctx)
+	found, err := employee.Discover(ctx, credentials.Username)
+	if err != nil {
+		logger.Warn("could not discover employee, using stored ids", elog.Fields{"user": credentials.Username, "err": err})
+		status := IdentityStatus{
+			Username:     credentials.Username,
+			StoredUserId: credentials.UserId,
+			StoredArgId:  credentials.ArgId,
+			UID:          found.UID,
+			Status:       IdentityError,
+			Error:        err.Error(),
+			CheckedAt:    time.Now(),
+		}
+		identities.Store(credentials.Username, status)
+		return credentials, status
+	}
+
+	resolved, status := reconcileIdentity(credentials, found)
+	identities.Store(credentials.Username, status)
+	switch status.Status {
+	case IdentityMismatch:
+		logger.Warn("stored ids do not match ERP", elog.Fields{"user": credentials.Username, "stored_user_id": credentials.UserId, "stored_arg_id": credentials.ArgId, "uid": found.UID, "employee_id": found.EmployeeID})
+	case IdentityFilled:
+		// Chỉ điền vào USER_STORE nếu user chưa bị thay bằng bản upload khác trong lúc chạy
+		if v, ok := USER_STORE.Load(credentials.Username); ok && v.(UserCredentials) == credentials {
+			USER_STORE.Store(credentials.Username, resolved)
+		}
+		logger.Info("filled user ids from ERP", elog.Fields{"user": credentials.Username, "uid": found.UID, "employee_id": found.EmployeeID})
+	}
+	return resolved, status
+}
+
+// DiscoverIdentity đăng nhập bằng credentials trong USER_STORE và tra lại uid/employee ID ngay
+func DiscoverIdentity(ctx context.Context, username string) (IdentityStatus, error) {
+	v, ok := USER_STORE.Load(username)
+	if !ok {
+		return IdentityStatus{}, ErrUserNotFound
+	}
+	credentials := v.(UserCredentials)
+	if _, err := erp.LookupInstance(credentials.Instance); err != nil {
+		return IdentityStatus{}, err
+	}
+	ctx = login.WithTOTPSecret(erp.WithInstance(ctx, credentials.Instance), credentials.TOTPSecret)
+	if err := login.DoLogin(ctx, credentials.Username, credentials.Password); err != nil {
+		return IdentityStatus{}, err
+	}
+	_, status := discoverIdentity(ctx, credentials)
+	return status, nil
+}
+
+// ListIdentities trả về kết quả tra cứu mới nhất của các user, sắp theo username
+func ListIdentities() []IdentityStatus {
+	result := make([]IdentityStatus, 0)
+	identities.Range(func(key, value interface{}) bool {
+		result = append(result, value.(IdentityStatus))
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool { return result[i].Username < result[j].Username })
+	return result
+}
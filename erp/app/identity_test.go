@@ -0,0 +1,33 @@
+package app
+
+import (
+	"testing"
+
+	"go-ngsc-erp/erp/employee"
+)
+
+func TestReconcileIdentity(t *testing.T) {
+	found := employee.Identity{UID: 6100, EmployeeID: 6303}
+	tests := []struct {
+		stored UserCredentials
+		want   string
+	}{
+		{UserCredentials{Username: "a", UserId: 6100, ArgId: 6303}, IdentityVerified},
+		{UserCredentials{Username: "a"}, IdentityFilled},
+		{UserCredentials{Username: "a", UserId: 6100}, IdentityFilled},
+		{UserCredentials{Username: "a", UserId: 6100, ArgId: 1}, IdentityMismatch},
+		{UserCredentials{Username: "a", UserId: 2}, IdentityMismatch},
+	}
+	for _, tt := range tests {
+		resolved, status := reconcileIdentity(tt.stored, found)
+		if status.Status != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.stored, status.Status, tt.want)
+		}
+		if resolved.UserId != 6100 || resolved.ArgId != 6303 {
+			t.Errorf("%+v: resolved to %+v", tt.stored, resolved)
+		}
+		if status.StoredUserId != tt.stored.UserId || status.StoredArgId != tt.stored.ArgId {
+			t.Errorf("%+v: stored ids not kept in status %+v", tt.stored, status)
+		}
+	}
+}
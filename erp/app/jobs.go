@@ -0,0 +1,209 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/metrics"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	RoutineMorning = "MORNING_ROUTINE"
+	RoutineEvening = "EVENING_ROUTINE"
+	JobKindDigest  = "DIGEST"
+)
+
+const (
+	JobKindRoutine = "ROUTINE"
+	JobKindOneTime = "ONE_TIME"
+)
+
+const (
+	JobStateScheduled = "SCHEDULED"
+	JobStateRunning   = "RUNNING"
+)
+
+var (
+	ErrSchedulerNotStarted = errors.New("scheduler is not started")
+	ErrJobNotFound         = errors.New("job not found")
+	ErrJobNotCancelable    = errors.New("routine jobs cannot be cancelled")
+	ErrJobAlreadyRunning   = errors.New("job is already running")
+	ErrJobNotDryRunnable   = errors.New("only one-time jobs can be dry-run")
+)
+
+// scheduler là cron đang chạy, nil khi chưa RunJob hoặc instance không còn là leader
+var scheduler atomic.Pointer[cron.Cron]
+
+// jobState đánh dấu job một lần đã bắt đầu chạy, tránh chạy hai lần khi vừa run-now vừa đến giờ cron
+type jobState struct {
+	started atomic.Bool
+}
+
+func (s *jobState) start() bool {
+	return s.started.CompareAndSwap(false, true)
+}
+
+func (s *jobState) String() string {
+	if s.started.Load() {
+		return JobStateRunning
+	}
+	return JobStateScheduled
+}
+
+// RoutineJob là job lặp lại hằng ngày, lên lịch các OneTimeJob cho từng user
+type RoutineJob struct {
+	Name    string
+	Fn      func()
+	running atomic.Bool
+}
+
+func (j *RoutineJob) Run() {
+	j.running.Store(true)
+	defer j.running.Store(false)
+	j.Fn()
+}
+
+type JobInfo struct {
+	ID       cron.EntryID `json:"id"`
+	Kind     string       `json:"kind"`
+	Name     string       `json:"name,omitempty"`
+	Username string       `json:"username,omitempty"`
+	Action   string       `json:"action,omitempty"`
+	NextRun  time.Time    `json:"nextRun"`
+	PrevRun  time.Time    `json:"prevRun"`
+	State    string       `json:"state"`
+}
+
+// ListJobs liệt kê toàn bộ entry của scheduler, sắp xếp theo thời gian chạy tiếp theo
+func ListJobs() ([]JobInfo, error) {
+	c := scheduler.Load()
+	if c == nil {
+		return nil, ErrSchedulerNotStarted
+	}
+	jobs := make([]JobInfo, 0)
+	for _, e := range c.Entries() {
+		info := JobInfo{ID: e.ID, NextRun: e.Next, PrevRun: e.Prev, State: JobStateScheduled}
+		switch j := e.Job.(type) {
+		case *OneTimeJob:
+			info.Kind = JobKindOneTime
+			info.Username = j.Username
+			info.Action = j.ActionType
+			info.State = j.state.String()
+		case *DigestJob:
+			info.Kind = JobKindOneTime
+			info.Name = JobKindDigest
+			info.State = j.state.String()
+		case *RoutineJob:
+			info.Kind = JobKindRoutine
+			info.Name = j.Name
+			if j.running.Load() {
+				info.State = JobStateRunning
+			}
+		}
+		jobs = append(jobs, info)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].NextRun.Before(jobs[k].NextRun)
+	})
+	return jobs, nil
+}
+
+func findEntry(id cron.EntryID) (cron.Entry, error) {
+	c := scheduler.Load()
+	if c == nil {
+		return cron.Entry{}, ErrSchedulerNotStarted
+	}
+	e := c.Entry(id)
+	if !e.Valid() {
+		return cron.Entry{}, ErrJobNotFound
+	}
+	return e, nil
+}
+
+// CancelJob xóa một job một lần chưa chạy khỏi scheduler
+func CancelJob(id cron.EntryID) error {
+	e, err := findEntry(id)
+	if err != nil {
+		return err
+	}
+	switch j := e.Job.(type) {
+	case *OneTimeJob:
+		if !j.state.start() {
+			return ErrJobAlreadyRunning
+		}
+		metrics.PendingJobs.Dec()
+		elog.Info("cancelled job", elog.Fields{"entry_id": id, "user": j.Username, "action": j.ActionType})
+	case *DigestJob:
+		if !j.state.start() {
+			return ErrJobAlreadyRunning
+		}
+		elog.Info("cancelled digest", elog.F("entry_id", id))
+	default:
+		return ErrJobNotCancelable
+	}
+	if c := scheduler.Load(); c != nil {
+		c.Remove(id)
+	}
+	return nil
+}
+
+// RunJobNow chạy ngay một job trong goroutine riêng, job một lần sẽ tự xóa sau khi chạy
+// force chỉ áp dụng cho job một lần, cho phép chấm công lại action đã thành công trong ngày.
+func RunJobNow(id cron.EntryID, force bool) error {
+	e, err := findEntry(id)
+	if err != nil {
+		return err
+	}
+	switch j := e.Job.(type) {
+	case *OneTimeJob:
+		if j.state.started.Load() {
+			return ErrJobAlreadyRunning
+		}
+	case *DigestJob:
+		if j.state.started.Load() {
+			return ErrJobAlreadyRunning
+		}
+	case *RoutineJob:
+		if j.running.Load() {
+			return ErrJobAlreadyRunning
+		}
+	}
+	elog.Info("run job now", elog.Fields{"entry_id": id, "force": force})
+	if j, ok := e.Job.(*OneTimeJob); ok && force {
+		go j.run(WithForce(context.Background()))
+		return nil
+	}
+	go e.Job.Run()
+	return nil
+}
+
+// DryRunJob chạy thử ngay một job một lần ở chế độ dry-run trong goroutine riêng.
+// Job vẫn giữ nguyên lịch chạy thật, kết quả DRY_RUN được ghi vào log như các lần chạy khác.
+func DryRunJob(id cron.EntryID, force bool) error {
+	e, err := findEntry(id)
+	if err != nil {
+		return err
+	}
+	j, ok := e.Job.(*OneTimeJob)
+	if !ok {
+		return ErrJobNotDryRunnable
+	}
+	credentials, ok := j.credentials()
+	if !ok {
+		return ErrUserNotFound
+	}
+	elog.Info("dry run job now", elog.Fields{"entry_id": id, "user": j.Username, "action": j.ActionType, "force": force})
+	ctx := erp.WithDryRun(context.Background(), true)
+	if force {
+		ctx = WithForce(ctx)
+	}
+	_, err = EnqueueAction(ctx, j.ActionType, credentials)
+	return err
+}
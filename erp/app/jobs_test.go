@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestOneTimeJobUsesCurrentCredentials(t *testing.T) {
+	c := cron.New()
+	USER_STORE.Store("job-rotated", UserCredentials{Username: "job-rotated", Password: "old"})
+	defer USER_STORE.Delete("job-rotated")
+	job := &OneTimeJob{Cron: c, Username: "job-rotated", ActionType: "CHECKIN"}
+
+	// Mật khẩu đổi sau khi routine đã lên lịch job
+	USER_STORE.Store("job-rotated", UserCredentials{Username: "job-rotated", Password: "new"})
+	done := make(chan struct{})
+	go func() {
+		job.run(context.Background())
+		close(done)
+	}()
+	task := <-actionQueue
+	if task.credentials.Password != "new" {
+		t.Errorf("job ran with password %q, want the updated one", task.credentials.Password)
+	}
+	task.result <- CsvAttendanceLog{Status: StatusSuccess}
+	<-done
+
+	removed := &OneTimeJob{Cron: c, Username: "job-removed", ActionType: "CHECKOUT"}
+	removed.run(context.Background())
+	if logged := <-CsvWriterChan; logged.Status != StatusSkipped || logged.ErrorDetail != "USER REMOVED" {
+		t.Errorf("removed user: logged %+v, want a skipped row", logged)
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go-ngsc-erp/internal/elog"
+)
+
+// Kích thước hàng đợi action chờ worker, đủ cho hai routine của vài trăm user
+const ActionQueueSize = 500
+
+var ErrActionQueueFull = errors.New("action queue is full")
+
+type actionTask struct {
+	ctx         context.Context
+	action      string
+	credentials UserCredentials
+	result      chan CsvAttendanceLog
+}
+
+var actionQueue = make(chan actionTask, ActionQueueSize)
+var actionsRunning atomic.Int32
+var workersOnce sync.Once
+
+// StartWorkers chạy n worker dùng chung cho mọi job chấm công, chỉ có tác dụng ở lần gọi đầu.
+// Gọi trước RunJob; số worker không đổi khi reload cấu hình.
+func StartWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	workersOnce.Do(func() {
+		for i := 0; i < n; i++ {
+			go actionWorker()
+		}
+		elog.Info("action workers started", elog.F("workers", n))
+	})
+}
+
+func actionWorker() {
+	for t := range actionQueue {
+		actionsRunning.Add(1)
+		t.result <- DoAction(t.ctx, t.action, t.credentials)
+		actionsRunning.Add(-1)
+	}
+}
+
+// EnqueueAction xếp action vào hàng đợi của worker pool, kết quả được gửi vào channel trả về khi chạy xong
+func EnqueueAction(ctx context.Context, action string, credentials UserCredentials) (<-chan CsvAttendanceLog, error) {
+	t := actionTask{ctx: ctx, action: action, credentials: credentials, result: make(chan CsvAttendanceLog, 1)}
+	select {
+	case actionQueue <- t:
+		return t.result, nil
+	default:
+		return nil, ErrActionQueueFull
+	}
+}
+
+// ActionQueueDepth trả về số action đang chờ worker
+func ActionQueueDepth() int {
+	return len(actionQueue)
+}
+
+// ActionsRunning trả về số action worker đang chạy
+func ActionsRunning() int {
+	return int(actionsRunning.Load())
+}
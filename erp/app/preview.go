@@ -0,0 +1,116 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go-ngsc-erp/internal/config"
+)
+
+// Khoảng thời gian tối đa của một lần xem trước, tránh trả về danh sách quá lớn
+const MaxPreviewDays = 62
+
+var (
+	ErrPreviewRange = errors.New("invalid preview range")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// ScheduleWindow là khoảng thời gian một action của user sẽ chạy: routine chạy lúc RoutineTime,
+// job của user được đặt ngẫu nhiên trong [Start, End] theo độ trễ tối đa của routine.
+type ScheduleWindow struct {
+	Username    string    `json:"username"`
+	Action      string    `json:"action"`
+	Routine     string    `json:"routine"`
+	RoutineTime time.Time `json:"routineTime"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+// PreviewOptions chọn khoảng thời gian, user và cron string muốn thử; cron rỗng thì dùng giá trị đang chạy
+type PreviewOptions struct {
+	From        time.Time
+	To          time.Time
+	Username    string
+	MorningCron string
+	EveningCron string
+}
+
+// PreviewSchedule liệt kê các khoảng thời gian routine sáng/chiều sẽ lên lịch CHECKIN/CHECKOUT trong [From, To),
+// sắp xếp theo thời gian bắt đầu rồi theo user. User đang tạm dừng và ngày trong schedule.holidays không có khoảng nào.
+// Chưa có lịch riêng cho từng user nên mọi user dùng chung cron của routine. Không thay đổi scheduler đang chạy.
+func PreviewSchedule(opts PreviewOptions) ([]ScheduleWindow, error) {
+	if !opts.To.After(opts.From) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrPreviewRange)
+	}
+	if opts.To.Sub(opts.From) > MaxPreviewDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: at most %d days", ErrPreviewRange, MaxPreviewDays)
+	}
+
+	morningCron, eveningCron, morningDelay, eveningDelay := scheduleSettings()
+	if opts.MorningCron != "" {
+		morningCron = opts.MorningCron
+	}
+	if opts.EveningCron != "" {
+		eveningCron = opts.EveningCron
+	}
+
+	// Giống morningRoutine/eveningRoutine: user tạm dừng hoặc có credentials bị từ chối không được lên lịch
+	usernames := make([]string, 0)
+	found := false
+	USER_STORE.Range(func(key, value interface{}) bool {
+		c := value.(UserCredentials)
+		if opts.Username != "" && key.(string) != opts.Username {
+			return true
+		}
+		found = true
+		if _, suppressed := credentialsSuppressed(c); c.Paused || suppressed {
+			return true
+		}
+		usernames = append(usernames, key.(string))
+		return true
+	})
+	if opts.Username != "" && !found {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, opts.Username)
+	}
+	sort.Strings(usernames)
+
+	routines := []struct {
+		name, cron, action string
+		maxDelay           int
+	}{
+		{RoutineMorning, morningCron, "CHECKIN", morningDelay},
+		{RoutineEvening, eveningCron, "CHECKOUT", eveningDelay},
+	}
+	windows := make([]ScheduleWindow, 0)
+	for _, r := range routines {
+		schedule, err := config.CronParser.Parse(r.cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s cron %q: %w", r.name, r.cron, err)
+		}
+		// Next trả về thời điểm sau tham số, lùi 1 giây để tính cả lần chạy đúng lúc From
+		for t := schedule.Next(opts.From.In(Location).Add(-time.Second)); !t.IsZero() && t.Before(opts.To); t = schedule.Next(t) {
+			if isHoliday(t) {
+				continue
+			}
+			for _, u := range usernames {
+				windows = append(windows, ScheduleWindow{
+					Username:    u,
+					Action:      r.action,
+					Routine:     r.name,
+					RoutineTime: t,
+					Start:       t.Add(time.Minute),
+					End:         t.Add(time.Duration(r.maxDelay) * time.Minute),
+				})
+			}
+		}
+	}
+	sort.SliceStable(windows, func(i, j int) bool {
+		if !windows[i].Start.Equal(windows[j].Start) {
+			return windows[i].Start.Before(windows[j].Start)
+		}
+		return windows[i].Username < windows[j].Username
+	})
+	return windows, nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPreviewSchedule(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		t.Fatalf("could not load timezone: %v", err)
+	}
+	oldLoc := Location
+	Location = loc
+	defer func() { Location = oldLoc }()
+
+	USER_STORE.Store("preview-a", UserCredentials{Username: "preview-a"})
+	USER_STORE.Store("preview-b", UserCredentials{Username: "preview-b"})
+	defer USER_STORE.Delete("preview-a")
+	defer USER_STORE.Delete("preview-b")
+
+	// Thứ 6 28/11/2025 đến hết Chủ nhật: chỉ một ngày làm việc
+	from := time.Date(2025, 11, 28, 0, 0, 0, 0, loc)
+	windows, err := PreviewSchedule(PreviewOptions{
+		From:        from,
+		To:          from.AddDate(0, 0, 3),
+		Username:    "preview-a",
+		MorningCron: "0 0 8 * * 1-5",
+		EveningCron: "0 45 17 * * 1-5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("got %d windows, want 2: %+v", len(windows), windows)
+	}
+	_, _, morningDelay, _ := scheduleSettings()
+	in := windows[0]
+	if in.Action != "CHECKIN" || !in.RoutineTime.Equal(time.Date(2025, 11, 28, 8, 0, 0, 0, loc)) {
+		t.Errorf("unexpected checkin window %+v", in)
+	}
+	if got := in.End.Sub(in.RoutineTime); got != time.Duration(morningDelay)*time.Minute {
+		t.Errorf("checkin window ends %v after routine, want %d minutes", got, morningDelay)
+	}
+	if windows[1].Action != "CHECKOUT" || windows[1].Username != "preview-a" {
+		t.Errorf("unexpected checkout window %+v", windows[1])
+	}
+
+	// User tạm dừng và user có credentials bị từ chối không được lên lịch
+	paused := UserCredentials{Username: "preview-paused", Paused: true}
+	suppressed := UserCredentials{Username: "preview-suppressed", Password: "old"}
+	USER_STORE.Store(paused.Username, paused)
+	USER_STORE.Store(suppressed.Username, suppressed)
+	defer USER_STORE.Delete(paused.Username)
+	defer USER_STORE.Delete(suppressed.Username)
+	defer credentialStates.Delete(suppressed.Username)
+	credentialStates.Store(suppressed.Username, CredentialState{Username: suppressed.Username, Status: CredentialInvalid, fingerprint: credentialFingerprint(suppressed)})
+	for _, u := range []string{paused.Username, suppressed.Username} {
+		windows, err := PreviewSchedule(PreviewOptions{From: from, To: from.AddDate(0, 0, 1), Username: u})
+		if err != nil || len(windows) != 0 {
+			t.Errorf("%s: got %d windows, %v; want none", u, len(windows), err)
+		}
+	}
+	all, err := PreviewSchedule(PreviewOptions{From: from, To: from.AddDate(0, 0, 1), MorningCron: "0 0 8 * * 1-5", EveningCron: "0 45 17 * * 1-5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := 0
+	for _, w := range all {
+		switch w.Username {
+		case paused.Username, suppressed.Username:
+			t.Errorf("unexpected window for %s", w.Username)
+		case "preview-a", "preview-b":
+			active++
+		}
+	}
+	if active != 4 {
+		t.Errorf("got %d windows, want 4 for the two active users", active)
+	}
+
+	// Ngày nghỉ không có khoảng nào, ngày làm việc sau đó vẫn được lên lịch
+	SetHolidays([]string{"2025-11-28"})
+	defer SetHolidays(nil)
+	holiday, err := PreviewSchedule(PreviewOptions{From: from, To: from.AddDate(0, 0, 4), Username: "preview-a", MorningCron: "0 0 8 * * 1-5", EveningCron: "0 45 17 * * 1-5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holiday) != 2 || holiday[0].RoutineTime.Day() != 1 {
+		t.Errorf("holiday should be skipped, got %+v", holiday)
+	}
+
+	if _, err := PreviewSchedule(PreviewOptions{From: from, To: from.AddDate(0, 0, 1), Username: "nobody"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: got %v, want ErrUserNotFound", err)
+	}
+	if _, err := PreviewSchedule(PreviewOptions{From: from, To: from}); !errors.Is(err, ErrPreviewRange) {
+		t.Errorf("empty range: got %v, want ErrPreviewRange", err)
+	}
+}
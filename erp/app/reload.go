@@ -0,0 +1,251 @@
+package app
+
+import (
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/notify"
+)
+
+const (
+	ReloadSourceWatch = "watch"
+	ReloadSourceAPI   = "api"
+)
+
+type ReloadResult struct {
+	Source       string    `json:"source"`
+	Time         time.Time `json:"time"`
+	Changed      []string  `json:"changed"`
+	Warnings     []string  `json:"warnings,omitempty"`
+	UsersAdded   int       `json:"usersAdded"`
+	UsersUpdated int       `json:"usersUpdated"`
+	UsersRemoved int       `json:"usersRemoved"`
+}
+
+var reloadMu sync.Mutex
+var configPath string
+var currentConfig config.Config
+
+// fileModTimes lưu thời điểm sửa đổi cuối của file cấu hình và file user mà watcher đã thấy
+var fileModTimes = make(map[string]time.Time)
+
+// InitReload ghi nhớ file cấu hình và cấu hình đang chạy để so sánh khi reload
+func InitReload(path string, cfg config.Config) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	configPath = path
+	currentConfig = cfg
+	fileModTimes[path] = modTime(path)
+	if cfg.Store.UsersFile != "" {
+		fileModTimes[cfg.Store.UsersFile] = modTime(cfg.Store.UsersFile)
+	}
+}
+
+// CurrentConfig trả về cấu hình đang được áp dụng
+func CurrentConfig() config.Config {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return currentConfig
+}
+
+// Reload đọc lại file cấu hình và file user rồi áp dụng các thay đổi: log level, ERP, routine cron,
+// độ trễ, ngày nghỉ, kênh digest và USER_STORE. Cấu hình lỗi sẽ bị bỏ qua toàn bộ, giữ nguyên cấu hình cũ.
+func Reload(source string) (ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	result := ReloadResult{Source: source, Time: time.Now(), Changed: make([]string, 0)}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		elog.Error("config reload failed", elog.Fields{"source": source, "err": err})
+		return result, err
+	}
+	var users []UserCredentials
+	if cfg.Store.UsersFile != "" {
+		users, err = LoadUsersFile(cfg.Store.UsersFile)
+		if err == nil {
+			err = CheckUserInstances(cfg.ERP, users)
+		}
+		if err != nil {
+			elog.Error("config reload failed", elog.Fields{"source": source, "err": err})
+			return result, err
+		}
+	}
+	old := currentConfig
+
+	// Chuẩn bị mọi thay đổi có thể lỗi trước khi áp dụng để cấu hình lỗi không bị áp dụng một nửa.
+	// Cron string đã được config.Load kiểm tra nên các bước Reschedule bên dưới không lỗi.
+	var digestNotifier notify.Notifier
+	if cfg.Digest != old.Digest {
+		digestNotifier, err = notify.New(cfg.Digest.Channel, cfg.Digest.WebhookURL)
+		if err != nil {
+			elog.Error("config reload failed", elog.Fields{"source": source, "err": err})
+			return result, err
+		}
+	}
+	// erp.Configure chỉ đổi cấu hình sau khi dựng xong transport, lỗi ở đây chưa áp dụng gì
+	if !reflect.DeepEqual(cfg.ERP, old.ERP) {
+		if err := erp.Configure(cfg.ERP); err != nil {
+			elog.Error("config reload failed", elog.Fields{"source": source, "err": err})
+			return result, err
+		}
+		result.Changed = append(result.Changed, "erp")
+	}
+
+	if cfg.Log.Level != old.Log.Level {
+		elog.SetLevel(cfg.Log.Level)
+		result.Changed = append(result.Changed, "log.level")
+	}
+	if cfg.Schedule.DailyMorningCron != old.Schedule.DailyMorningCron || cfg.Schedule.DailyEveningCron != old.Schedule.DailyEveningCron {
+		if err := RescheduleRoutines(cfg.Schedule.DailyMorningCron, cfg.Schedule.DailyEveningCron); err != nil {
+			elog.Error("could not reschedule routines", elog.Fields{"source": source, "err": err})
+		} else {
+			result.Changed = append(result.Changed, "schedule.crons")
+		}
+	}
+	if cfg.Schedule.CredentialCheckCron != old.Schedule.CredentialCheckCron {
+		if err := RescheduleCredentialCheck(cfg.Schedule.CredentialCheckCron); err != nil {
+			elog.Error("could not reschedule credential check", elog.Fields{"source": source, "err": err})
+		} else {
+			result.Changed = append(result.Changed, "schedule.credentialCheckCron")
+		}
+	}
+	if cfg.Schedule.MaxMorningDelayMinutes != old.Schedule.MaxMorningDelayMinutes || cfg.Schedule.MaxEveningDelayMinutes != old.Schedule.MaxEveningDelayMinutes {
+		SetMaxDelays(cfg.Schedule.MaxMorningDelayMinutes, cfg.Schedule.MaxEveningDelayMinutes)
+		result.Changed = append(result.Changed, "schedule.maxDelays")
+	}
+	if !slices.Equal(cfg.Schedule.Holidays, old.Schedule.Holidays) {
+		SetHolidays(cfg.Schedule.Holidays)
+		result.Changed = append(result.Changed, "schedule.holidays")
+	}
+	if digestNotifier != nil {
+		SetDigestNotifier(digestNotifier)
+		result.Changed = append(result.Changed, "digest")
+	}
+	// Sink và danh sách field ẩn được dựng một lần lúc khởi động (cli), reload không áp dụng lại
+	if !reflect.DeepEqual(cfg.Log.Sinks, old.Log.Sinks) {
+		result.Warnings = append(result.Warnings, "log.sinks changes need a restart")
+	}
+	if !reflect.DeepEqual(cfg.Log.RedactFields, old.Log.RedactFields) {
+		result.Warnings = append(result.Warnings, "log.redactFields changes need a restart")
+	}
+	if cfg.Log.RecentSize != old.Log.RecentSize {
+		result.Warnings = append(result.Warnings, "log.recentSize changes need a restart")
+	}
+	if cfg.Schedule.Timezone != old.Schedule.Timezone {
+		result.Warnings = append(result.Warnings, "schedule.timezone changes need a restart")
+	}
+	if cfg.Store.CsvPath != old.Store.CsvPath {
+		result.Warnings = append(result.Warnings, "store.csvPath changes need a restart")
+	}
+	if cfg.Store.IdempotencyFile != old.Store.IdempotencyFile {
+		result.Warnings = append(result.Warnings, "store.idempotencyFile changes need a restart")
+	}
+	if cfg.Server != old.Server {
+		result.Warnings = append(result.Warnings, "server changes need a restart")
+	}
+	if cfg.Reload != old.Reload {
+		result.Warnings = append(result.Warnings, "reload settings changes need a restart")
+	}
+	if cfg.ERP.MaxConcurrentActions != old.ERP.MaxConcurrentActions {
+		result.Warnings = append(result.Warnings, "erp.maxConcurrentActions changes need a restart")
+	}
+	if cfg.Leader != old.Leader {
+		result.Warnings = append(result.Warnings, "leader settings changes need a restart")
+	}
+	if !reflect.DeepEqual(cfg.Portal, old.Portal) {
+		result.Warnings = append(result.Warnings, "portal settings changes need a restart")
+	}
+
+	if cfg.Store.UsersFile != "" {
+		result.UsersAdded, result.UsersUpdated, result.UsersRemoved = replaceUsers(users)
+		if result.UsersAdded+result.UsersUpdated+result.UsersRemoved > 0 {
+			result.Changed = append(result.Changed, "users")
+		}
+		fileModTimes[cfg.Store.UsersFile] = modTime(cfg.Store.UsersFile)
+	}
+	fileModTimes[configPath] = modTime(configPath)
+	currentConfig = cfg
+
+	elog.Info("config reloaded", elog.Fields{
+		"source":        source,
+		"changed":       result.Changed,
+		"warnings":      result.Warnings,
+		"users_added":   result.UsersAdded,
+		"users_updated": result.UsersUpdated,
+		"users_removed": result.UsersRemoved,
+	})
+	return result, nil
+}
+
+// replaceUsers đồng bộ USER_STORE với danh sách trong store.usersFile. User thêm qua POST /upload, portal
+// hay PUT credentials cũng được ghi vào file (storeUsers) nên không bị xóa ở đây.
+func replaceUsers(users []UserCredentials) (added, updated, removed int) {
+	incoming := make(map[string]UserCredentials, len(users))
+	for _, u := range users {
+		incoming[u.Username] = u
+	}
+	USER_STORE.Range(func(key, value interface{}) bool {
+		if _, ok := incoming[key.(string)]; !ok {
+			USER_STORE.Delete(key)
+			removed++
+		}
+		return true
+	})
+	for username, u := range incoming {
+		prev, ok := USER_STORE.Load(username)
+		switch {
+		case !ok:
+			added++
+		case prev.(UserCredentials) != u:
+			updated++
+		default:
+			continue
+		}
+		USER_STORE.Store(username, u)
+	}
+	return added, updated, removed
+}
+
+// WatchConfig kiểm tra định kỳ thời điểm sửa đổi của file cấu hình và file user, reload khi có thay đổi
+func WatchConfig(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !watchedFilesChanged() {
+			continue
+		}
+		_, _ = Reload(ReloadSourceWatch)
+	}
+}
+
+func watchedFilesChanged() bool {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	paths := []string{configPath}
+	if currentConfig.Store.UsersFile != "" {
+		paths = append(paths, currentConfig.Store.UsersFile)
+	}
+	for _, p := range paths {
+		if !modTime(p).Equal(fileModTimes[p]) {
+			// ghi nhận ngay để file lỗi không bị reload lặp lại mỗi chu kỳ
+			fileModTimes[p] = modTime(p)
+			return true
+		}
+	}
+	return false
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+)
+
+func TestReloadKeepsUploadedUsers(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	usersPath := filepath.Join(dir, "users.json")
+	base := "store:\n  csvPath: " + filepath.Join(dir, "attendance.csv") + "\n  usersFile: " + usersPath + "\n"
+	if err := os.WriteFile(cfgPath, []byte(base), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveUsersFile(usersPath, []UserCredentials{{Username: "reload-file"}}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath, oldCfg := configPath, currentConfig
+	defer func() { configPath, currentConfig = oldPath, oldCfg }()
+	defer USER_STORE.Delete("reload-file")
+	defer USER_STORE.Delete("reload-upload")
+	InitReload(cfgPath, cfg)
+
+	if err := AddUsers([]UserCredentials{{Username: "reload-upload"}}); err != nil {
+		t.Fatalf("add users: %v", err)
+	}
+	if _, err := Reload(ReloadSourceAPI); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, ok := USER_STORE.Load("reload-upload"); !ok {
+		t.Fatal("uploaded user was removed by reload")
+	}
+	users, err := LoadUsersFile(usersPath)
+	if err != nil || len(users) != 2 {
+		t.Fatalf("users file = %+v, %v; want both users", users, err)
+	}
+
+	withLog := base + "log:\n  redactFields: [employee_pin]\n  sinks:\n    - type: console\n      format: text\n"
+	if err := os.WriteFile(cfgPath, []byte(withLog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Reload(ReloadSourceAPI)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	for _, want := range []string{"log.sinks changes need a restart", "log.redactFields changes need a restart"} {
+		if !slices.Contains(result.Warnings, want) {
+			t.Errorf("warnings = %v, want %q", result.Warnings, want)
+		}
+	}
+
+	// caFile không tồn tại làm hỏng erp, log level trong cùng file không được áp dụng
+	broken := base + "log:\n  level: error\nerp:\n  http:\n    caFile: " + filepath.Join(dir, "missing.pem") + "\n"
+	level := elog.GetLevel()
+	if err := os.WriteFile(cfgPath, []byte(broken), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Reload(ReloadSourceAPI); err == nil {
+		t.Fatal("reload with a missing caFile should fail")
+	}
+	if got := elog.GetLevel(); got != level {
+		t.Fatalf("log level = %v after failed reload, want %v", got, level)
+	}
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+)
+
+// LoadUsersFile đọc danh sách UserCredentials từ file JSON
+func LoadUsersFile(path string) ([]UserCredentials, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file %s: %w", path, err)
+	}
+	var users []UserCredentials
+	if err := json.Unmarshal(raw, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse users file %s: %w", path, err)
+	}
+	return users, nil
+}
+
+// CheckUserInstances trả về lỗi cho từng user gắn với instance không có trong cfg.Instances,
+// có secret TOTP không hợp lệ hoặc có secret TOTP trong khi instance đăng nhập bằng jsonrpc (không hỗ trợ 2FA)
+func CheckUserInstances(cfg config.ERPConfig, users []UserCredentials) error {
+	var errs []error
+	for _, u := range users {
+		if u.TOTPSecret != "" {
+			if _, err := login.TOTPCode(u.TOTPSecret, time.Now()); err != nil {
+				errs = append(errs, fmt.Errorf("user %s: %w", u.Username, err))
+			}
+		}
+		inst, ok := cfg.Instance(u.Instance)
+		if !ok {
+			errs = append(errs, fmt.Errorf("user %s: %w: %s", u.Username, erp.ErrUnknownInstance, u.Instance))
+			continue
+		}
+		if u.TOTPSecret != "" && inst.LoginMethod == config.LoginMethodJSONRPC {
+			errs = append(errs, fmt.Errorf("user %s: %w (instance %s)", u.Username, login.ErrTOTPUnsupported, u.InstanceName()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SaveUsersFile ghi danh sách user ra file JSON, ghi qua file tạm rồi rename để watcher không đọc file dở dang
+func SaveUsersFile(path string, users []UserCredentials) error {
+	raw, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode users: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("failed to write users file %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace users file %s: %w", path, err)
+	}
+	return nil
+}
+
+// AddUsers thêm hoặc thay user trong USER_STORE (POST /upload). Khi có store.usersFile, user được ghi vào file
+// để lần reload sau không xóa mất user vừa thêm.
+func AddUsers(users []UserCredentials) error {
+	if err := CheckUserInstances(erp.Settings(), users); err != nil {
+		return err
+	}
+	return storeUsers(users...)
+}
+
+// storeUsers ghi user vào store.usersFile (nếu có) rồi vào USER_STORE. Giữ reloadMu để Reload không đọc file
+// giữa hai bước và ghi nhận thời điểm sửa file để watcher không reload lại chính thay đổi này.
+func storeUsers(users ...UserCredentials) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if path := currentConfig.Store.UsersFile; path != "" {
+		if err := mergeUsersFile(path, users); err != nil {
+			return err
+		}
+		fileModTimes[path] = modTime(path)
+	}
+	for _, u := range users {
+		USER_STORE.Store(u.Username, u)
+	}
+	return nil
+}
+
+// mergeUsersFile thay các user trùng username trong file và thêm các user mới vào cuối
+func mergeUsersFile(path string, users []UserCredentials) error {
+	existing, err := LoadUsersFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	index := make(map[string]int, len(existing))
+	for i, u := range existing {
+		index[u.Username] = i
+	}
+	for _, u := range users {
+		if i, ok := index[u.Username]; ok {
+			existing[i] = u
+			continue
+		}
+		index[u.Username] = len(existing)
+		existing = append(existing, u)
+	}
+	return SaveUsersFile(path, existing)
+}
+
+// SetPaused bật/tắt tạm dừng chấm công theo lịch của user, ghi vào store.usersFile nếu có cấu hình.
+// Job đã lên lịch của user bị bỏ qua khi đến giờ chạy.
+func SetPaused(username string, paused bool) error {
+	v, ok := USER_STORE.Load(username)
+	if !ok {
+		return ErrUserNotFound
+	}
+	c := v.(UserCredentials)
+	c.Paused = paused
+	if err := storeUsers(c); err != nil {
+		return err
+	}
+	elog.Info("user automation paused", elog.Fields{"user": username, "paused": paused})
+	return nil
+}
+
+// RunUserAction xếp một action chạy tay cho user vào worker pool, không chờ kết quả
+func RunUserAction(ctx context.Context, username, action string) (<-chan CsvAttendanceLog, error) {
+	if action != "CHECKIN" && action != "CHECKOUT" {
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+	v, ok := USER_STORE.Load(username)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return EnqueueAction(ctx, action, v.(UserCredentials))
+}
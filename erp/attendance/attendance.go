@@ -1,26 +1,38 @@
 package attendance
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go-ngsc-erp/erp"
 	"go-ngsc-erp/erp/login"
 	"math/rand"
+	"net"
+	"net/http"
 	"time"
 
 	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/metrics"
 
 	"resty.dev/v3"
 )
 
-const (
-	TIMEZONE_DEFAULT = "Asia/Saigon"
-	FIXED_LATITUDE   = 21.051364 // Ví dụ: Hà Nội
-	FIXED_LONGITUDE  = 105.799611
-	EN_LOCATION_ID   = "2"
-)
+// ErrOutcomeUnknown: request chấm công có thể đã tới ERP nhưng không biết kết quả (timeout, mất kết nối, 502/504).
+// attendance_manual đảo trạng thái nên không được gửi lại như một lần thất bại.
+var ErrOutcomeUnknown = errors.New("attendance outcome is unknown")
+
+// requestNotSent cho biết lỗi xảy ra trước khi request được gửi đi (kết nối, DNS, TLS)
+func requestNotSent(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	return (errors.As(err, &opErr) && opErr.Op == "dial") || errors.As(err, &dnsErr) || errors.As(err, &certErr)
+}
 
-func BuildAttendanceJSON(userArgID int, userID int) DataJSON {
+func BuildAttendanceJSON(ctx context.Context, userArgID int, userID int) DataJSON {
+	logger := elog.FromContext(ctx).With(elog.F(elog.OverridePackage, "attendance"))
 	// Khởi tạo seed cho hàm rand dựa trên thời gian hiện tại
 	// CHÚ Ý: Trong môi trường production, nên sử dụng crypto/rand để có tính bảo mật cao hơn
 	rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -28,15 +40,16 @@ func BuildAttendanceJSON(userArgID int, userID int) DataJSON {
 	// 1. Sinh ID ngẫu nhiên từ 1 đến 100
 	requestID := rand.Intn(100) + 1
 
-	// 2. Định nghĩa Context
+	// 2. Định nghĩa Context theo cấu hình ERP
+	settings := erp.SettingsFor(ctx)
 	context := Context{
-		Lang:              "vi_VN",
-		TZ:                TIMEZONE_DEFAULT,
+		Lang:              settings.Lang,
+		TZ:                settings.Timezone,
 		UID:               userID,
-		AllowedCompanyIDs: []int{1}, // Giả định company ID luôn là 1
-		Latitude:          FIXED_LATITUDE,
-		Longitude:         FIXED_LONGITUDE,
-		EnLocationID:      EN_LOCATION_ID,
+		AllowedCompanyIDs: settings.CompanyIDs,
+		Latitude:          settings.Latitude,
+		Longitude:         settings.Longitude,
+		EnLocationID:      settings.LocationID,
 	}
 
 	// 3. Định nghĩa Kwargs và Params
@@ -61,60 +74,79 @@ func BuildAttendanceJSON(userArgID int, userID int) DataJSON {
 	}
 
 	jsonVal, _ := json.Marshal(dataJSON)
-	elog.Info(string(jsonVal), elog.F("ts", time.Now().Format(time.RFC3339)))
-	elog.Debug("Built attendance JSON", elog.Fields{"request_id": requestID, "user_id": userID, "user_arg_id": userArgID})
+	logger.Info(string(jsonVal), elog.F("ts", time.Now().Format(time.RFC3339)))
+	logger.Debug("Built attendance JSON", elog.Fields{"request_id": requestID, "user_id": userID, "user_arg_id": userArgID})
 	return dataJSON
 }
 
-func DoAttendance(username string, userId, userArgId int) error {
+func DoAttendance(ctx context.Context, username string, userId, userArgId int) error {
+	logger := elog.FromContext(ctx).With(elog.F(elog.OverridePackage, "attendance"))
 	loginSessionVal, ok := login.LOGIN_SESSION.Load(username)
 	if !ok {
-		elog.Error("login session missing", elog.F("user", username))
-		return fmt.Errorf("need login first " + username)
+		logger.Error("login session missing", elog.F("user", username))
+		return fmt.Errorf("need login first %s", username)
 	}
 	loginSession := loginSessionVal.(*login.Session)
 	if loginSession.ExpireTime.Compare(time.Now()) < 0 {
-		elog.Warn("login session expired", elog.F("user", username))
-		return fmt.Errorf("need login first " + username)
+		logger.Warn("login session expired", elog.F("user", username))
+		return fmt.Errorf("need login first %s", username)
 	}
 
-	elog.Info("login session OK", elog.Fields{"user": username, "session_expires": loginSession.ExpireTime.Format(time.RFC3339)})
-	dataJSON := BuildAttendanceJSON(userArgId, userId)
+	logger.Info("login session OK", elog.Fields{"user": username, "session_expires": loginSession.ExpireTime.Format(time.RFC3339)})
+	dataJSON := BuildAttendanceJSON(ctx, userArgId, userId)
+	if erp.DryRun(ctx) {
+		logger.Info("dry run: skipping attendance request", elog.Fields{"user": username, "data": dataJSON})
+		return nil
+	}
 
-	restyClient := resty.New()
+	restyClient := erp.NewClient()
 	defer func(restyClient *resty.Client) {
 		err := restyClient.Close()
 		if err != nil {
-			elog.Error("error closing resty client", elog.F("err", err))
+			logger.Error("error closing resty client", elog.F("err", err))
 		}
 	}(restyClient)
 
-	attendanceUrl := erp.ROOT_NGSC_URL + erp.ATTENDANCE_PREFIX_URL
-	elog.Debug("posting attendance", elog.Fields{"url": attendanceUrl, "user": username})
+	settings := erp.SettingsFor(ctx)
+	attendanceUrl := settings.BaseURL + erp.ATTENDANCE_PREFIX_URL
+	logger.Debug("posting attendance", elog.Fields{"url": attendanceUrl, "user": username})
+	if err := erp.Wait(ctx); err != nil {
+		return err
+	}
+	requestStart := time.Now()
 	postResp, err := restyClient.R().
+		SetContext(ctx).
 		SetBody(dataJSON).
-		SetCookies(login.CreateLoginCookies(loginSession.SessionId)).
+		SetCookies(login.CreateLoginCookies(ctx, loginSession.SessionId)).
 		SetHeaders(map[string]string{
 			"Accept":       "*/*",
 			"Content-Type": "application/json",
-			"Origin":       "https://erp-ngsc.com.vn",
-			"Referer":      erp.ROOT_NGSC_URL,
+			"Origin":       settings.Origin(),
+			"Referer":      settings.BaseURL,
 			"User-Agent":   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36",
 		}).
 		Post(attendanceUrl)
+	metrics.ObserveERPRequest(erp.ATTENDANCE_PREFIX_URL, http.MethodPost, requestStart)
 
 	if err != nil {
-		elog.Error("error posting attendance", elog.Fields{"err": err, "user": username})
-		return err
+		logger.Error("error posting attendance", elog.Fields{"err": err, "user": username})
+		if requestNotSent(err) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrOutcomeUnknown, err)
 	}
 
 	attendanceStt := postResp.StatusCode()
 	if attendanceStt != 200 {
-		elog.Warn("attendance http code not 200", elog.Fields{"code": attendanceStt, "body": postResp.String(), "user": username})
+		logger.Warn("attendance http code not 200", elog.Fields{"code": attendanceStt, "body": postResp.String(), "user": username})
+		// Gateway hết thời gian chờ hoặc mất kết nối tới Odoo: request có thể đã được xử lý
+		if attendanceStt == http.StatusBadGateway || attendanceStt == http.StatusGatewayTimeout {
+			return fmt.Errorf("%w: code is not 200: httpCode %d", ErrOutcomeUnknown, attendanceStt)
+		}
 		return fmt.Errorf("code is not 200: httpCode %d", attendanceStt)
 	}
 
-	elog.Info("Attendance success", elog.F("user", username))
+	logger.Info("Attendance success", elog.F("user", username))
 
 	return nil
 }
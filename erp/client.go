@@ -0,0 +1,87 @@
+package erp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go-ngsc-erp/internal/config"
+
+	"golang.org/x/net/publicsuffix"
+	"resty.dev/v3"
+)
+
+// transport dùng chung cho mọi request tới ERP để tái sử dụng kết nối
+var transport atomic.Pointer[http.Transport]
+
+// NewTransport tạo transport theo erp.http: timeout kết nối, keep-alive, số kết nối rảnh, proxy và CA riêng
+func NewTransport(cfg config.HTTPConfig) (*http.Transport, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			// url.Error chứa nguyên url, có thể có mật khẩu proxy
+			return nil, fmt.Errorf("invalid erp.http.proxyUrl: %w", errors.Unwrap(err))
+		}
+		proxy = http.ProxyURL(u)
+	}
+	var tlsConfig *tls.Config
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read erp.http.caFile: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in erp.http.caFile %s", cfg.CAFile)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(cfg.DialTimeoutSeconds) * time.Second,
+		KeepAlive: time.Duration(cfg.KeepAliveSeconds) * time.Second,
+	}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   time.Duration(cfg.DialTimeoutSeconds) * time.Second,
+		ResponseHeaderTimeout: time.Duration(cfg.TimeoutSeconds) * time.Second,
+		IdleConnTimeout:       time.Duration(cfg.IdleConnTimeoutSeconds) * time.Second,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		ForceAttemptHTTP2:     true,
+	}, nil
+}
+
+func currentTransport() *http.Transport {
+	if t := transport.Load(); t != nil {
+		return t
+	}
+	t, _ := NewTransport(config.Default().ERP.HTTP)
+	transport.CompareAndSwap(nil, t)
+	return transport.Load()
+}
+
+// NewClient trả về resty client dùng transport chung và cookie jar riêng, mỗi lần đăng nhập/chấm công
+// dùng một client để session của các user không lẫn vào nhau. Mỗi request bị giới hạn bởi erp.http.timeoutSeconds
+// và deadline của context truyền qua SetContext, tùy cái nào đến trước.
+func NewClient() *resty.Client {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return resty.NewWithClient(&http.Client{
+		Transport: currentTransport(),
+		Jar:       jar,
+		Timeout:   time.Duration(Settings().HTTP.TimeoutSeconds) * time.Second,
+	})
+}
@@ -0,0 +1,50 @@
+package erp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/internal/config"
+)
+
+func TestNewClientHonorsContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	if err := Configure(config.Default().ERP); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewClient().R().SetContext(ctx).Get(srv.URL)
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("request took %v, context deadline was not honored", elapsed)
+	}
+}
+
+func TestNewTransportRejectsBadCAFile(t *testing.T) {
+	cfg := config.Default().ERP.HTTP
+	cfg.CAFile = filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(cfg.CAFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTransport(cfg); err == nil {
+		t.Fatal("expected an error for a CA file without certificates")
+	}
+}
@@ -0,0 +1,66 @@
+package employee
+
+// Identity là uid Odoo và employee ID của user đang đăng nhập, tương ứng userId và argId của UserCredentials
+type Identity struct {
+	UID          int    `json:"uid"`
+	EmployeeID   int    `json:"employeeId"`
+	EmployeeName string `json:"employeeName"`
+}
+
+// rpcRequest là body JSON-RPC chung cho các lời gọi /web/...
+type rpcRequest struct {
+	ID      int         `json:"id"`
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Name    string `json:"name"`
+		Message string `json:"message"`
+	} `json:"data"`
+}
+
+type sessionInfoResponse struct {
+	Result *struct {
+		UID interface{} `json:"uid"`
+	} `json:"result"`
+	Error *rpcError `json:"error"`
+}
+
+// searchReadParams là params của call_kw hr.employee/search_read
+type searchReadParams struct {
+	Model  string        `json:"model"`
+	Method string        `json:"method"`
+	Args   []interface{} `json:"args"`
+	Kwargs searchKwargs  `json:"kwargs"`
+}
+
+type searchKwargs struct {
+	Fields  []string               `json:"fields"`
+	Limit   int                    `json:"limit"`
+	Context map[string]interface{} `json:"context"`
+}
+
+type employeeRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type searchReadResponse struct {
+	Result []employeeRecord `json:"result"`
+	Error  *rpcError        `json:"error"`
+}
+
+type attendanceStateRecord struct {
+	ID              int    `json:"id"`
+	AttendanceState string `json:"attendance_state"`
+}
+
+type attendanceStateResponse struct {
+	Result []attendanceStateRecord `json:"result"`
+	Error  *rpcError               `json:"error"`
+}
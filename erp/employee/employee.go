@@ -0,0 +1,197 @@
+package employee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/metrics"
+
+	"resty.dev/v3"
+)
+
+var (
+	ErrUIDNotFound       = errors.New("uid not found in session info")
+	ErrEmployeeNotFound  = errors.New("no employee linked to the logged-in user")
+	ErrMultipleEmployees = errors.New("more than one employee linked to the logged-in user")
+	ErrUnknownAttendance = errors.New("employee attendance state is unknown")
+)
+
+// Trạng thái chấm công của hr.employee (field attendance_state)
+const (
+	StateCheckedIn  = "checked_in"
+	StateCheckedOut = "checked_out"
+)
+
+// Discover tìm uid và employee ID của user từ session đăng nhập hiện tại.
+// uid lấy từ Session (đăng nhập JSON-RPC) hoặc /web/session/get_session_info,
+// employee lấy bằng hr.employee search_read với user_id = uid.
+func Discover(ctx context.Context, username string) (Identity, error) {
+	logger := elog.FromContext(ctx).With(elog.F(elog.OverridePackage, "employee"))
+	sessionVal, ok := login.LOGIN_SESSION.Load(username)
+	if !ok {
+		return Identity{}, fmt.Errorf("need login first %s", username)
+	}
+	session := sessionVal.(*login.Session)
+	if session.ExpireTime.Before(time.Now()) {
+		return Identity{}, fmt.Errorf("need login first %s", username)
+	}
+
+	restyClient := erp.NewClient()
+	defer func(restyClient *resty.Client) {
+		err := restyClient.Close()
+		if err != nil {
+			logger.Error("error closing resty client", elog.F("err", err))
+		}
+	}(restyClient)
+
+	uid := session.UID
+	if uid <= 0 {
+		var info sessionInfoResponse
+		if err := call(ctx, restyClient, session.SessionId, erp.SESSION_INFO_PREFIX_URL, struct{}{}, &info); err != nil {
+			return Identity{}, err
+		}
+		if info.Error != nil {
+			return Identity{}, info.Error
+		}
+		if info.Result != nil {
+			if v, ok := info.Result.UID.(float64); ok {
+				uid = int(v)
+			}
+		}
+		if uid <= 0 {
+			return Identity{}, ErrUIDNotFound
+		}
+	}
+
+	settings := erp.SettingsFor(ctx)
+	params := searchReadParams{
+		Model:  "hr.employee",
+		Method: "search_read",
+		Args:   []interface{}{[]interface{}{[]interface{}{"user_id", "=", uid}}},
+		Kwargs: searchKwargs{
+			Fields: []string{"id", "name"},
+			// Lấy 2 bản ghi để phát hiện user gắn với nhiều employee
+			Limit: 2,
+			Context: map[string]interface{}{
+				"lang":                settings.Lang,
+				"tz":                  settings.Timezone,
+				"uid":                 uid,
+				"allowed_company_ids": settings.CompanyIDs,
+			},
+		},
+	}
+	var found searchReadResponse
+	if err := call(ctx, restyClient, session.SessionId, erp.EMPLOYEE_SEARCH_PREFIX_URL, params, &found); err != nil {
+		return Identity{}, err
+	}
+	if found.Error != nil {
+		return Identity{}, found.Error
+	}
+	switch len(found.Result) {
+	case 0:
+		return Identity{UID: uid}, fmt.Errorf("%w: uid %d", ErrEmployeeNotFound, uid)
+	case 1:
+	default:
+		return Identity{UID: uid}, fmt.Errorf("%w: uid %d", ErrMultipleEmployees, uid)
+	}
+	identity := Identity{UID: uid, EmployeeID: found.Result[0].ID, EmployeeName: found.Result[0].Name}
+	logger.Info("discovered employee", elog.Fields{"user": username, "uid": identity.UID, "employee_id": identity.EmployeeID})
+	return identity, nil
+}
+
+// AttendanceState đọc attendance_state hiện tại của employee trên ERP bằng session đăng nhập của username.
+// attendance_manual đảo trạng thái, nên nơi gọi dùng kết quả để không chấm công ngược chiều.
+func AttendanceState(ctx context.Context, username string, employeeID int) (string, error) {
+	logger := elog.FromContext(ctx).With(elog.F(elog.OverridePackage, "employee"))
+	sessionVal, ok := login.LOGIN_SESSION.Load(username)
+	if !ok {
+		return "", fmt.Errorf("need login first %s", username)
+	}
+	session := sessionVal.(*login.Session)
+	if session.ExpireTime.Before(time.Now()) {
+		return "", fmt.Errorf("need login first %s", username)
+	}
+
+	restyClient := erp.NewClient()
+	defer func(restyClient *resty.Client) {
+		err := restyClient.Close()
+		if err != nil {
+			logger.Error("error closing resty client", elog.F("err", err))
+		}
+	}(restyClient)
+
+	settings := erp.SettingsFor(ctx)
+	params := searchReadParams{
+		Model:  "hr.employee",
+		Method: "search_read",
+		Args:   []interface{}{[]interface{}{[]interface{}{"id", "=", employeeID}}},
+		Kwargs: searchKwargs{
+			Fields: []string{"id", "attendance_state"},
+			Limit:  1,
+			Context: map[string]interface{}{
+				"lang":                settings.Lang,
+				"tz":                  settings.Timezone,
+				"allowed_company_ids": settings.CompanyIDs,
+			},
+		},
+	}
+	var found attendanceStateResponse
+	if err := call(ctx, restyClient, session.SessionId, erp.EMPLOYEE_SEARCH_PREFIX_URL, params, &found); err != nil {
+		return "", err
+	}
+	if found.Error != nil {
+		return "", found.Error
+	}
+	if len(found.Result) != 1 {
+		return "", fmt.Errorf("%w: employee %d not found", ErrUnknownAttendance, employeeID)
+	}
+	switch state := found.Result[0].AttendanceState; state {
+	case StateCheckedIn, StateCheckedOut:
+		return state, nil
+	default:
+		return "", fmt.Errorf("%w: employee %d has state %q", ErrUnknownAttendance, employeeID, state)
+	}
+}
+
+// call gửi một request JSON-RPC tới settings.BaseURL + path bằng session đã đăng nhập
+func call(ctx context.Context, restyClient *resty.Client, sessionId, path string, params, out interface{}) error {
+	settings := erp.SettingsFor(ctx)
+	if err := erp.Wait(ctx); err != nil {
+		return err
+	}
+	requestStart := time.Now()
+	resp, err := restyClient.R().
+		SetContext(ctx).
+		SetBody(rpcRequest{ID: rand.Intn(1000) + 1, JSONRPC: "2.0", Method: "call", Params: params}).
+		SetResult(out).
+		SetCookies(login.CreateLoginCookies(ctx, sessionId)).
+		SetHeaders(map[string]string{
+			"Accept":       "application/json",
+			"Content-Type": "application/json",
+			"Origin":       settings.Origin(),
+			"Referer":      settings.BaseURL,
+		}).
+		Post(settings.BaseURL + path)
+	metrics.ObserveERPRequest(path, http.MethodPost, requestStart)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("code is not 200: httpCode %d", resp.StatusCode())
+	}
+	return nil
+}
+
+func (e *rpcError) Error() string {
+	if e.Data.Message != "" {
+		return fmt.Sprintf("%s: %s", e.Data.Name, e.Data.Message)
+	}
+	return e.Message
+}
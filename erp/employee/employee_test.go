@@ -0,0 +1,102 @@
+package employee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/config"
+)
+
+// fakeOdoo trả uid 6100 từ get_session_info và các employee trong employees cho search_read
+func fakeOdoo(t *testing.T, employees string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session_id"); err != nil || c.Value != "sid" {
+			http.Error(w, "no session", http.StatusForbidden)
+			return
+		}
+		var req struct {
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/web/session/get_session_info":
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"uid":6100,"name":"Duy"}}`))
+		case "/web/dataset/call_kw/hr.employee/search_read":
+			var p searchReadParams
+			_ = json.Unmarshal(req.Params, &p)
+			if p.Model != "hr.employee" || len(p.Args) != 1 {
+				t.Errorf("unexpected search_read params %s", req.Params)
+			}
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + employees + `}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func useServer(t *testing.T, srv *httptest.Server) {
+	cfg := config.Default().ERP
+	cfg.BaseURL = srv.URL + "/web"
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	login.LOGIN_SESSION.Store("duy", &login.Session{Username: "duy", SessionId: "sid", ExpireTime: time.Now().Add(time.Hour)})
+	t.Cleanup(func() {
+		login.LOGIN_SESSION.Delete("duy")
+		_ = erp.Configure(config.Default().ERP)
+		srv.Close()
+	})
+}
+
+func TestDiscover(t *testing.T) {
+	useServer(t, fakeOdoo(t, `[{"id":6303,"name":"Duy"}]`))
+	got, err := Discover(context.Background(), "duy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (Identity{UID: 6100, EmployeeID: 6303, EmployeeName: "Duy"}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestDiscoverEmployeeErrors(t *testing.T) {
+	tests := map[string]error{
+		`[]`: ErrEmployeeNotFound,
+		`[{"id":1,"name":"A"},{"id":2,"name":"B"}]`: ErrMultipleEmployees,
+	}
+	for employees, want := range tests {
+		t.Run(employees, func(t *testing.T) {
+			useServer(t, fakeOdoo(t, employees))
+			got, err := Discover(context.Background(), "duy")
+			if !errors.Is(err, want) {
+				t.Fatalf("got %v, want %v", err, want)
+			}
+			if got.UID != 6100 {
+				t.Errorf("uid should still be returned, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestAttendanceState(t *testing.T) {
+	useServer(t, fakeOdoo(t, `[{"id":6303,"attendance_state":"checked_in"}]`))
+	got, err := AttendanceState(context.Background(), "duy", 6303)
+	if err != nil || got != StateCheckedIn {
+		t.Fatalf("got %q, %v; want %q", got, err, StateCheckedIn)
+	}
+
+	useServer(t, fakeOdoo(t, `[]`))
+	if _, err := AttendanceState(context.Background(), "duy", 6303); !errors.Is(err, ErrUnknownAttendance) {
+		t.Errorf("missing employee: got %v, want ErrUnknownAttendance", err)
+	}
+}
@@ -1,15 +1,109 @@
 package erp
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"go-ngsc-erp/internal/config"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
 )
 
-const ROOT_NGSC_URL = "https://erp-ngsc.com.vn/web"
 const LOGIN_PREFIX_URL = "/login"
 const ATTENDANCE_PREFIX_URL = "/dataset/call_kw/hr.employee/attendance_manual"
-const REQUEST_COOKIE_HEADER = "cids=1; frontend_lang=vi_VN; tz=Asia/Saigon; session_id=%s"
+const TOTP_PREFIX_URL = "/login/totp"
+const AUTHENTICATE_PREFIX_URL = "/session/authenticate"
+const SESSION_INFO_PREFIX_URL = "/session/get_session_info"
+const EMPLOYEE_SEARCH_PREFIX_URL = "/dataset/call_kw/hr.employee/search_read"
+
+var settings atomic.Pointer[config.ERPConfig]
+
+// Configure thay cấu hình ERP đang dùng (base URL, ngôn ngữ, timezone, company...).
+// Transport chỉ được tạo lại khi erp.http thay đổi, request đang chạy vẫn dùng transport cũ.
+func Configure(cfg config.ERPConfig) error {
+	if old := settings.Load(); old == nil || old.HTTP != cfg.HTTP || transport.Load() == nil {
+		t, err := NewTransport(cfg.HTTP)
+		if err != nil {
+			return err
+		}
+		if prev := transport.Swap(t); prev != nil {
+			prev.CloseIdleConnections()
+		}
+	}
+	settings.Store(&cfg)
+	limiter.setRate(cfg.RequestsPerSecond, cfg.RequestBurst)
+	return nil
+}
+
+// Settings trả về cấu hình ERP hiện tại, mặc định là config.Default().ERP
+func Settings() config.ERPConfig {
+	if cfg := settings.Load(); cfg != nil {
+		return *cfg
+	}
+	return config.Default().ERP
+}
+
+var ErrUnknownInstance = errors.New("unknown erp instance")
+
+type instanceKey struct{}
+
+// WithInstance chọn ERP instance (erp.instances) cho các request chạy với ctx
+func WithInstance(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, instanceKey{}, name)
+}
+
+// InstanceName trả về instance đã chọn bằng WithInstance, mặc định là config.DefaultInstance
+func InstanceName(ctx context.Context) string {
+	if name, _ := ctx.Value(instanceKey{}).(string); name != "" {
+		return name
+	}
+	return config.DefaultInstance
+}
+
+// LookupInstance trả về cấu hình đã gộp của instance name, lỗi ErrUnknownInstance nếu chưa khai báo
+func LookupInstance(name string) (config.ERPConfig, error) {
+	cfg, ok := Settings().Instance(name)
+	if !ok {
+		return cfg, fmt.Errorf("%w: %s", ErrUnknownInstance, name)
+	}
+	return cfg, nil
+}
+
+// SettingsFor trả về cấu hình ERP của instance trong ctx. Instance không tồn tại (ví dụ vừa bị xóa khi reload)
+// dùng erp.* mặc định; nơi gọi nên kiểm tra trước bằng LookupInstance.
+func SettingsFor(ctx context.Context) config.ERPConfig {
+	if cfg, err := LookupInstance(InstanceName(ctx)); err == nil {
+		return cfg
+	}
+	return Settings()
+}
+
+type dryRunKey struct{}
+
+// WithDryRun bật/tắt dry-run cho riêng các action chạy với ctx, bỏ qua erp.dryRun
+func WithDryRun(ctx context.Context, dryRun bool) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, dryRun)
+}
+
+// DryRun cho biết action chạy với ctx có bỏ qua request chấm công hay không
+func DryRun(ctx context.Context) bool {
+	if v, ok := ctx.Value(dryRunKey{}).(bool); ok {
+		return v
+	}
+	return Settings().DryRun
+}
+
+// CompanyIDsCookie nối các company ID thành giá trị cookie cids, ví dụ "1,2"
+func CompanyIDsCookie(ids []int) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
 
 func FindByRegex(regexPattern, sourceVal string) (string, error) {
 	re := regexp.MustCompile(regexPattern)
@@ -1,12 +1,30 @@
 package login
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"go-ngsc-erp/internal/elog"
+)
 
 type Session struct {
 	Username   string `json:"username"`
 	SessionId  string `json:"sessionId"`
 	LoginTime  time.Time
 	ExpireTime time.Time
+	// UID và UserContext chỉ có khi đăng nhập qua JSON-RPC /web/session/authenticate
+	UID         int                    `json:"uid,omitempty"`
+	UserContext map[string]interface{} `json:"userContext,omitempty"`
+}
+
+// Redact ẩn session id khi Session được ghi log
+func (s Session) Redact() interface{} {
+	s.SessionId = elog.RedactedValue
+	return s
+}
+
+func (s Session) String() string {
+	return fmt.Sprintf("Session{username=%s, uid=%d, expire=%s}", s.Username, s.UID, s.ExpireTime.Format(time.RFC3339))
 }
 
 type LoginRequest struct {
@@ -15,3 +33,39 @@ type LoginRequest struct {
 	Password  string `json:"password" form:"password"`
 	Redirect  string `json:"redirect" form:"redirect"`
 }
+
+// AuthenticateRequest là body JSON-RPC của /web/session/authenticate
+type AuthenticateRequest struct {
+	JSONRPC string             `json:"jsonrpc"`
+	Method  string             `json:"method"`
+	ID      int                `json:"id"`
+	Params  AuthenticateParams `json:"params"`
+}
+
+type AuthenticateParams struct {
+	DB       string `json:"db"`
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// AuthenticateResponse chỉ giữ các field cần dùng; uid là false khi sai mật khẩu ở một số bản Odoo
+type AuthenticateResponse struct {
+	Result *AuthenticateResult `json:"result"`
+	Error  *RPCError           `json:"error"`
+}
+
+type AuthenticateResult struct {
+	UID         interface{}            `json:"uid"`
+	UserContext map[string]interface{} `json:"user_context"`
+	Username    string                 `json:"username"`
+	DB          string                 `json:"db"`
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Name    string `json:"name"`
+		Message string `json:"message"`
+	} `json:"data"`
+}
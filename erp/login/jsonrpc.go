@@ -0,0 +1,123 @@
+package login
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/metrics"
+
+	"resty.dev/v3"
+)
+
+// Thời hạn session khi cookie session_id không có Expires/Max-Age
+const defaultSessionLifetime = 24 * time.Hour
+
+// authenticateJSONRPC đăng nhập qua /web/session/authenticate với db, login, password
+// và lưu Session kèm uid, user_context trả về từ Odoo. Endpoint này không hoàn tất được bước 2FA
+// nên user có secret TOTP bị từ chối trước khi gửi request.
+func authenticateJSONRPC(ctx context.Context, logger *elog.Logger, username, password string) error {
+	if totpSecret(ctx) != "" {
+		return ErrTOTPUnsupported
+	}
+	restyClient := erp.NewClient()
+	defer func(restyClient *resty.Client) {
+		err := restyClient.Close()
+		if err != nil {
+			logger.Error("error closing resty client", elog.F("err", err))
+		}
+	}(restyClient)
+
+	settings := erp.SettingsFor(ctx)
+	authURL := settings.BaseURL + erp.AUTHENTICATE_PREFIX_URL
+	body := AuthenticateRequest{
+		JSONRPC: "2.0",
+		Method:  "call",
+		ID:      rand.Intn(1000) + 1,
+		Params:  AuthenticateParams{DB: settings.Database, Login: username, Password: password},
+	}
+
+	if err := erp.Wait(ctx); err != nil {
+		return err
+	}
+	var out AuthenticateResponse
+	requestStart := time.Now()
+	resp, err := restyClient.R().
+		SetContext(ctx).
+		SetBody(body).
+		SetResult(&out).
+		SetHeaders(map[string]string{
+			"Accept":       "application/json",
+			"Content-Type": "application/json",
+			"Origin":       settings.Origin(),
+		}).
+		Post(authURL)
+	metrics.ObserveERPRequest(erp.AUTHENTICATE_PREFIX_URL, http.MethodPost, requestStart)
+	if err != nil {
+		logger.Error("error posting authenticate", elog.Fields{"err": err, "user": username})
+		return err
+	}
+
+	session, err := parseAuthenticateResponse(resp.StatusCode(), out, username)
+	if err != nil {
+		logger.Warn("Login not valid", elog.Fields{"code": resp.StatusCode(), "user": username, "err": err})
+		return err
+	}
+	sessionIdCookie, err := erp.FindFromCookie("session_id", resp.Cookies())
+	if err != nil {
+		logger.Error("session cookie after authenticate not found", elog.F("err", err))
+		return err
+	}
+	session.SessionId = sessionIdCookie.Value
+	session.ExpireTime = sessionExpiry(sessionIdCookie)
+	logger.Info("new session", elog.Fields{"session_id": session.SessionId, "expire": session.ExpireTime.Format(time.RFC3339), "user": username, "uid": session.UID})
+
+	addLoginSession(logger, session)
+	logger.Info("Finish login process", elog.F("user", username))
+	return nil
+}
+
+// parseAuthenticateResponse chuyển response JSON-RPC thành Session (chưa có session id) hoặc lỗi đăng nhập
+func parseAuthenticateResponse(status int, out AuthenticateResponse, username string) (Session, error) {
+	if out.Error != nil {
+		message := out.Error.Data.Message
+		if message == "" {
+			message = out.Error.Message
+		}
+		lower := strings.ToLower(message)
+		for _, m := range lockedMessages {
+			if strings.Contains(lower, m) {
+				return Session{}, fmt.Errorf("%w: %s", ErrAccountLocked, message)
+			}
+		}
+		if strings.HasSuffix(out.Error.Data.Name, "AccessDenied") {
+			return Session{}, fmt.Errorf("%w: %s", ErrInvalidCredentials, message)
+		}
+		return Session{}, fmt.Errorf("%w: %s: %s", ErrUnexpectedPage, out.Error.Data.Name, message)
+	}
+	if status != http.StatusOK || out.Result == nil {
+		return Session{}, fmt.Errorf("%w: httpCode %d", ErrUnexpectedPage, status)
+	}
+	// Sai mật khẩu trả lỗi AccessDenied ở trên; uid rỗng nghĩa là mật khẩu đúng nhưng Odoo chờ bước 2FA
+	uid, ok := out.Result.UID.(float64)
+	if !ok || uid <= 0 {
+		return Session{}, ErrTOTPUnsupported
+	}
+	return Session{Username: username, UID: int(uid), UserContext: out.Result.UserContext}, nil
+}
+
+// sessionExpiry lấy hạn của cookie session_id, ưu tiên Max-Age rồi đến Expires
+func sessionExpiry(c *http.Cookie) time.Time {
+	if c.MaxAge > 0 {
+		return time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+	}
+	if !c.Expires.IsZero() {
+		return c.Expires
+	}
+	return time.Now().Add(defaultSessionLifetime)
+}
@@ -0,0 +1,100 @@
+package login
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/internal/config"
+)
+
+// fakeAuthenticate giả lập /web/session/authenticate của Odoo với một tài khoản hợp lệ
+func fakeAuthenticate(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/web/session/authenticate" {
+			http.NotFound(w, r)
+			return
+		}
+		var req AuthenticateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// Tài khoản bật 2FA: mật khẩu đúng nhưng uid rỗng cho đến khi nhập mã
+		if req.Params.Login == "totp@ngs.com.vn" && req.Params.Password == "secret" {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"uid":null,"db":"ngsc","username":"totp@ngs.com.vn"}}`))
+			return
+		}
+		if req.Params.DB != "ngsc" || req.Params.Login != "duydv@ngs.com.vn" || req.Params.Password != "secret" {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":200,"message":"Odoo Server Error","data":{"name":"odoo.exceptions.AccessDenied","message":"Access Denied"}}}`))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "sid-6100", Path: "/", MaxAge: 3600})
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"uid":6100,"db":"ngsc","username":"duydv@ngs.com.vn","user_context":{"lang":"vi_VN","tz":"Asia/Saigon","uid":6100}}}`))
+	}))
+}
+
+func TestDoLoginJSONRPC(t *testing.T) {
+	srv := fakeAuthenticate(t)
+	defer srv.Close()
+
+	cfg := config.Default().ERP
+	cfg.BaseURL = srv.URL + "/web"
+	cfg.LoginMethod = config.LoginMethodJSONRPC
+	cfg.Database = "ngsc"
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = erp.Configure(config.Default().ERP) }()
+	defer LOGIN_SESSION.Delete("duydv@ngs.com.vn")
+
+	if err := DoLogin(context.Background(), "duydv@ngs.com.vn", "secret"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	v, ok := LOGIN_SESSION.Load("duydv@ngs.com.vn")
+	if !ok {
+		t.Fatal("session not stored")
+	}
+	s := v.(*Session)
+	if s.SessionId != "sid-6100" || s.UID != 6100 || s.UserContext["tz"] != "Asia/Saigon" {
+		t.Errorf("unexpected session %+v", s)
+	}
+
+	err := DoLogin(context.Background(), "duydv@ngs.com.vn", "wrong")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+	if err := DoLogin(context.Background(), "totp@ngs.com.vn", "secret"); !errors.Is(err, ErrTOTPUnsupported) {
+		t.Errorf("2fa account: got %v, want ErrTOTPUnsupported", err)
+	}
+	if err := DoLogin(WithTOTPSecret(context.Background(), "JBSWY3DPEHPK3PXP"), "duydv@ngs.com.vn", "secret"); !errors.Is(err, ErrTOTPUnsupported) {
+		t.Errorf("totp secret with jsonrpc: got %v, want ErrTOTPUnsupported", err)
+	}
+}
+
+func TestDoLoginInstance(t *testing.T) {
+	srv := fakeAuthenticate(t)
+	defer srv.Close()
+
+	// ERP mặc định không truy cập được, user chỉ đăng nhập được qua instance hcm
+	cfg := config.Default().ERP
+	cfg.BaseURL = "http://127.0.0.1:1/web"
+	cfg.Instances = []config.ERPInstance{{Name: "hcm", BaseURL: srv.URL + "/web", LoginMethod: config.LoginMethodJSONRPC, Database: "ngsc", CompanyIDs: []int{2}}}
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = erp.Configure(config.Default().ERP) }()
+	defer LOGIN_SESSION.Delete("duydv@ngs.com.vn")
+
+	ctx := erp.WithInstance(context.Background(), "hcm")
+	if err := DoLogin(ctx, "duydv@ngs.com.vn", "secret"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if got := CreateLoginCookies(ctx, "sid")[0]; got.Name != "cids" || got.Value != "2" {
+		t.Errorf("cookie should use instance companies, got %s=%s", got.Name, got.Value)
+	}
+}
@@ -1,74 +1,87 @@
 package login
 
 import (
+	"context"
 	"fmt"
 	"go-ngsc-erp/erp"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
+	"go-ngsc-erp/internal/config"
 	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/metrics"
 
 	"resty.dev/v3"
 )
 
 var LOGIN_SESSION = sync.Map{}
 
-func addLoginSession(username string, sessionId string, expireTime time.Time) {
-	loginSession := Session{
-		Username:   username,
-		SessionId:  sessionId,
-		LoginTime:  time.Now(),
-		ExpireTime: expireTime,
-	}
-	LOGIN_SESSION.Store(username, &loginSession)
-	elog.Info("Added login session", elog.F("user", username))
+func addLoginSession(logger *elog.Logger, loginSession Session) {
+	loginSession.LoginTime = time.Now()
+	LOGIN_SESSION.Store(loginSession.Username, &loginSession)
+	logger.Info("Added login session", elog.Fields{"user": loginSession.Username, "uid": loginSession.UID})
 }
 
-func DoLogin(username, password string) error {
+func DoLogin(ctx context.Context, username, password string) (err error) {
+	logger := elog.FromContext(ctx).With(elog.F(elog.OverridePackage, "login"))
+	defer func() {
+		metrics.LoginAttempts.WithLabelValues(username, metrics.Outcome(err)).Inc()
+	}()
 	currentTime := time.Now()
-	elog.Info("Start login process", elog.Fields{"user": username, "ts": currentTime.Format("15:04:05")})
-	restyClient := resty.New()
+	settings := erp.SettingsFor(ctx)
+	logger.Info("Start login process", elog.Fields{"user": username, "ts": currentTime.Format("15:04:05"), "method": settings.LoginMethod, "instance": erp.InstanceName(ctx)})
+	if settings.LoginMethod == config.LoginMethodJSONRPC {
+		return authenticateJSONRPC(ctx, logger, username, password)
+	}
+	restyClient := erp.NewClient()
 	defer func(restyClient *resty.Client) {
 		err := restyClient.Close()
 		if err != nil {
-			elog.Error("error closing resty client", elog.F("err", err))
+			logger.Error("error closing resty client", elog.F("err", err))
 		}
 	}(restyClient)
 
-	loginUrl := erp.ROOT_NGSC_URL + erp.LOGIN_PREFIX_URL
-	elog.Debug("login url", elog.F("url", loginUrl))
+	loginUrl := settings.BaseURL + erp.LOGIN_PREFIX_URL
+	logger.Debug("login url", elog.F("url", loginUrl))
 
-	getResp, err := restyClient.R().Get(loginUrl)
+	if err := erp.Wait(ctx); err != nil {
+		return err
+	}
+	requestStart := time.Now()
+	getResp, err := restyClient.R().SetContext(ctx).Get(loginUrl)
+	metrics.ObserveERPRequest(erp.LOGIN_PREFIX_URL, http.MethodGet, requestStart)
 	if err != nil {
-		elog.Error("error fetching login page", elog.Fields{"err": err, "user": username})
+		logger.Error("error fetching login page", elog.Fields{"err": err, "user": username})
 		return err
 	}
 	if getResp.StatusCode() != 200 {
-		elog.Warn("login page returned non-200", elog.Fields{"code": getResp.StatusCode(), "body": getResp.String()})
+		logger.Warn("login page returned non-200", elog.Fields{"code": getResp.StatusCode(), "body_len": len(getResp.String())})
 		return fmt.Errorf("code is not 200: httpCode %d", getResp.StatusCode())
 	}
-	htmlBody := getResp.String()
-	csrfToken, err := erp.FindByRegex(`csrf_token: *"([^\"]+)"`, htmlBody)
+	csrfToken, err := ParseCSRFToken(getResp.String())
 	if err != nil {
-		elog.Error("csrf token not found", elog.F("err", err))
+		logger.Error("csrf token not found", elog.Fields{"err": err, "body_len": len(getResp.String())})
 		return err
 	}
-	csrfToken = strings.Replace(strings.Replace(csrfToken, "\"", "", -1), "csrf_token: ", "", -1)
-	elog.Debug("csrf token parsed", elog.F("token_len", len(csrfToken)))
+	logger.Debug("csrf token parsed", elog.F("token_len", len(csrfToken)))
 
 	sessionIdCookie, err := erp.FindFromCookie("session_id", getResp.Cookies())
 	if err != nil {
-		elog.Error("session cookie not found", elog.F("err", err))
+		logger.Error("session cookie not found", elog.F("err", err))
 		return err
 	}
-	elog.Debug("initial session id found", elog.F("cookie", sessionIdCookie.Value))
+	logger.Debug("initial session id found", elog.F("session_id", sessionIdCookie.Value))
 	sessionId := sessionIdCookie.Value
 
+	if err := erp.Wait(ctx); err != nil {
+		return err
+	}
+	requestStart = time.Now()
 	postResp, err := restyClient.R().
-		SetCookies(CreateLoginCookies(sessionId)).
+		SetContext(ctx).
+		SetCookies(CreateLoginCookies(ctx, sessionId)).
 		SetFormData(map[string]string{
 			"csrf_token": csrfToken,
 			"login":      username,
@@ -76,28 +89,37 @@ func DoLogin(username, password string) error {
 		}).
 		SetContentType("application/x-www-form-urlencoded").
 		Post(loginUrl)
+	metrics.ObserveERPRequest(erp.LOGIN_PREFIX_URL, http.MethodPost, requestStart)
 	if err != nil {
-		elog.Error("error posting login form", elog.F("err", err))
+		logger.Error("error posting login form", elog.F("err", err))
 		return err
 	}
 
 	loginPostStt := postResp.StatusCode()
-	if (loginPostStt != 200 && loginPostStt != 303 && loginPostStt != 302) || strings.Contains(postResp.String(), "Login") {
-		elog.Warn("Login not valid", elog.Fields{"code": loginPostStt, "body": postResp.String(), "user": username})
-		return fmt.Errorf("Login not valid: httpCode %d", loginPostStt)
+	if err := CheckLoginResponse(loginPostStt, postResp.String()); err != nil {
+		logger.Warn("Login not valid", elog.Fields{"code": loginPostStt, "body_len": len(postResp.String()), "user": username, "err": err})
+		return err
 	}
 
-	sessionIdCookie, err = erp.FindFromCookie("session_id", postResp.Cookies())
+	if challenge, ok := ParseTOTPChallenge(postResp.String()); ok {
+		postResp, err = completeTOTP(ctx, logger, restyClient, settings, username, challenge)
+		if err != nil {
+			logger.Warn("Login not valid", elog.Fields{"user": username, "err": err})
+			return err
+		}
+	}
+
+	sessionIdCookie, err = sessionCookie(restyClient, postResp)
 	if err != nil {
-		elog.Error("session cookie after login not found", elog.F("err", err))
+		logger.Error("session cookie after login not found", elog.F("err", err))
 		return err
 	}
 	sessionId = sessionIdCookie.Value
-	expireTime := sessionIdCookie.Expires
-	elog.Info("new session", elog.Fields{"session_id": sessionId, "expire": expireTime.Format(time.RFC3339), "user": username})
+	expireTime := sessionExpiry(sessionIdCookie)
+	logger.Info("new session", elog.Fields{"session_id": sessionId, "expire": expireTime.Format(time.RFC3339), "user": username})
 
-	addLoginSession(username, sessionId, expireTime)
-	elog.Info("Finish login process", elog.F("user", username))
+	addLoginSession(logger, Session{Username: username, SessionId: sessionId, ExpireTime: expireTime})
+	logger.Info("Finish login process", elog.F("user", username))
 
 	// if running under short-lived CLI tests we may want to flush
 	if os.Getenv("CI") == "true" {
@@ -107,12 +129,70 @@ func DoLogin(username, password string) error {
 	return nil
 }
 
-func CreateLoginCookies(sessionID string) []*http.Cookie {
+// sessionCookie lấy session_id từ response cuối, nếu không có thì từ cookie jar
+// (Odoo có thể đặt session mới ở response redirect trung gian, ví dụ sau bước TOTP)
+func sessionCookie(restyClient *resty.Client, resp *resty.Response) (*http.Cookie, error) {
+	if c, err := erp.FindFromCookie("session_id", resp.Cookies()); err == nil {
+		return c, nil
+	}
+	if jar := restyClient.CookieJar(); jar != nil && resp.RawResponse != nil && resp.RawResponse.Request != nil {
+		return erp.FindFromCookie("session_id", jar.Cookies(resp.RawResponse.Request.URL))
+	}
+	return nil, fmt.Errorf("cookie not found")
+}
+
+// CheckLoginPage kiểm tra trang đăng nhập của một ERP instance có truy cập được và đúng là form đăng nhập
+func CheckLoginPage(instance string, timeout time.Duration) error {
+	settings, err := erp.LookupInstance(instance)
+	if err != nil {
+		return err
+	}
+	restyClient := erp.NewClient()
+	defer func(restyClient *resty.Client) {
+		err := restyClient.Close()
+		if err != nil {
+			elog.Error("error closing resty client", elog.F("err", err))
+		}
+	}(restyClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := erp.Wait(ctx); err != nil {
+		return err
+	}
+	resp, err := restyClient.R().SetContext(ctx).Get(settings.BaseURL + erp.LOGIN_PREFIX_URL)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("code is not 200: httpCode %d", resp.StatusCode())
+	}
+	// Trang bảo trì hoặc lỗi proxy vẫn có thể trả về 200, chỉ coi là sẵn sàng khi có csrf_token
+	_, err = ParseCSRFToken(resp.String())
+	return err
+}
+
+// ActiveSessionCount trả về số session đăng nhập chưa hết hạn
+func ActiveSessionCount() int {
+	count := 0
+	now := time.Now()
+	LOGIN_SESSION.Range(func(key, value interface{}) bool {
+		if value.(*Session).ExpireTime.After(now) {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// CreateLoginCookies tạo cookie cho request đã đăng nhập theo company, ngôn ngữ và timezone của instance trong ctx
+func CreateLoginCookies(ctx context.Context, sessionID string) []*http.Cookie {
+	settings := erp.SettingsFor(ctx)
 	cookies := []*http.Cookie{
-		{Name: "cids", Value: "1"},
+		{Name: "cids", Value: erp.CompanyIDsCookie(settings.CompanyIDs)},
 		{Name: "session_id", Value: sessionID},
-		{Name: "frontend_lang", Value: "vi_VN"},
-		{Name: "tz", Value: "Asia/Saigon"},
+		{Name: "frontend_lang", Value: settings.Lang},
+		{Name: "tz", Value: settings.Timezone},
 	}
 	return cookies
 }
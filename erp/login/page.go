@@ -0,0 +1,213 @@
+package login
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	ErrCSRFNotFound       = errors.New("csrf token not found on login page")
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	ErrAccountLocked      = errors.New("account is locked or temporarily blocked")
+	ErrUnexpectedPage     = errors.New("unexpected page from ERP")
+	ErrTOTPRequired       = errors.New("two-factor code required but no totp secret configured")
+	ErrTOTPInvalid        = errors.New("two-factor code rejected")
+	// ErrTOTPUnsupported: tài khoản cần 2FA nhưng instance đăng nhập bằng jsonrpc, không phải lỗi mật khẩu
+	ErrTOTPUnsupported = errors.New("two-factor login is not supported by the jsonrpc login method")
+	// ErrInvalidTOTPSecret: secret TOTP không phải base32 hợp lệ
+	ErrInvalidTOTPSecret = errors.New("invalid totp secret")
+)
+
+// Token trong script của Odoo, ví dụ: odoo.__session_info__ = {... csrf_token: "abc" ...}
+var csrfScriptPattern = regexp.MustCompile(`["']?csrf_token["']?\s*:\s*["']([^"']+)["']`)
+
+// Nội dung thông báo lỗi của Odoo khi bị chặn đăng nhập, so khớp không phân biệt hoa thường
+var lockedMessages = []string{
+	"too many login failures",
+	"locked",
+	"quá nhiều lần đăng nhập",
+	"bị khóa",
+}
+
+// ParseCSRFToken lấy csrf_token từ input ẩn của form đăng nhập, nếu không có thì tìm trong script inline
+func ParseCSRFToken(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnexpectedPage, err)
+	}
+	if input := findNode(doc, func(n *html.Node) bool {
+		return isElement(n, "input") && attr(n, "name") == "csrf_token" && attr(n, "value") != ""
+	}); input != nil {
+		return attr(input, "value"), nil
+	}
+
+	var token string
+	findNode(doc, func(n *html.Node) bool {
+		if !isElement(n, "script") {
+			return false
+		}
+		if m := csrfScriptPattern.FindStringSubmatch(nodeText(n)); m != nil {
+			token = m[1]
+			return true
+		}
+		return false
+	})
+	if token == "" {
+		return "", ErrCSRFNotFound
+	}
+	return token, nil
+}
+
+// CheckLoginResponse phân loại response của POST đăng nhập (sau khi đã theo redirect).
+// Trang trả về vẫn là form đăng nhập nghĩa là thất bại: alert của Odoo cho biết sai mật khẩu hay bị khóa.
+func CheckLoginResponse(status int, body string) error {
+	if status != http.StatusOK && status != http.StatusFound && status != http.StatusSeeOther {
+		return fmt.Errorf("%w: httpCode %d", ErrUnexpectedPage, status)
+	}
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnexpectedPage, err)
+	}
+	if !hasLoginForm(doc) {
+		return nil
+	}
+
+	alert := findNode(doc, func(n *html.Node) bool {
+		return hasClass(n, "alert-danger") || (attr(n, "role") == "alert" && !hasClass(n, "alert-success") && !hasClass(n, "alert-info"))
+	})
+	if alert == nil {
+		return fmt.Errorf("%w: login form returned without an error message", ErrUnexpectedPage)
+	}
+	message := strings.Join(strings.Fields(nodeText(alert)), " ")
+	lower := strings.ToLower(message)
+	for _, m := range lockedMessages {
+		if strings.Contains(lower, m) {
+			return fmt.Errorf("%w: %s", ErrAccountLocked, message)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidCredentials, message)
+}
+
+// TOTPChallenge là form nhập mã xác thực hai lớp (/web/login/totp) Odoo trả về sau khi đúng mật khẩu
+type TOTPChallenge struct {
+	CsrfToken string
+	// Action là thuộc tính action của form, thường là /web/login/totp
+	Action string
+}
+
+// ParseTOTPChallenge trả về form TOTP nếu body là trang yêu cầu mã xác thực hai lớp
+func ParseTOTPChallenge(body string) (TOTPChallenge, bool) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil || !hasTOTPForm(doc) {
+		return TOTPChallenge{}, false
+	}
+	challenge := TOTPChallenge{}
+	if input := findNode(doc, func(n *html.Node) bool {
+		return isElement(n, "input") && attr(n, "name") == "csrf_token"
+	}); input != nil {
+		challenge.CsrfToken = attr(input, "value")
+	}
+	if form := findNode(doc, func(n *html.Node) bool {
+		return isElement(n, "form") && findNode(n, func(c *html.Node) bool {
+			return isElement(c, "input") && attr(c, "name") == "totp_token"
+		}) != nil
+	}); form != nil {
+		challenge.Action = attr(form, "action")
+	}
+	return challenge, true
+}
+
+// CheckTOTPResponse phân loại response sau khi gửi mã TOTP: vẫn là form TOTP nghĩa là mã bị từ chối,
+// quay về form đăng nhập nghĩa là phiên đăng nhập dở dang đã hết hạn.
+func CheckTOTPResponse(status int, body string) error {
+	if status != http.StatusOK && status != http.StatusFound && status != http.StatusSeeOther {
+		return fmt.Errorf("%w: httpCode %d", ErrUnexpectedPage, status)
+	}
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnexpectedPage, err)
+	}
+	if hasLoginForm(doc) {
+		return fmt.Errorf("%w: login form returned after totp", ErrUnexpectedPage)
+	}
+	if !hasTOTPForm(doc) {
+		return nil
+	}
+	if alert := findNode(doc, func(n *html.Node) bool { return hasClass(n, "alert-danger") }); alert != nil {
+		return fmt.Errorf("%w: %s", ErrTOTPInvalid, strings.Join(strings.Fields(nodeText(alert)), " "))
+	}
+	return ErrTOTPInvalid
+}
+
+func hasTOTPForm(doc *html.Node) bool {
+	return findNode(doc, func(n *html.Node) bool {
+		return isElement(n, "input") && attr(n, "name") == "totp_token"
+	}) != nil
+}
+
+// hasLoginForm nhận diện form đăng nhập của Odoo qua hai input login và password
+func hasLoginForm(doc *html.Node) bool {
+	hasInput := func(name string) bool {
+		return findNode(doc, func(n *html.Node) bool {
+			return isElement(n, "input") && attr(n, "name") == name
+		}) != nil
+	}
+	return hasInput("login") && hasInput("password")
+}
+
+func findNode(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findNode(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func isElement(n *html.Node, tag string) bool {
+	return n.Type == html.ElementNode && n.Data == tag
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
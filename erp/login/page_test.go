@@ -0,0 +1,93 @@
+package login
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden")
+
+// TestLoginPageGolden chạy ParseCSRFToken và CheckLoginResponse trên các trang mẫu trong testdata,
+// so sánh với file .golden cùng tên. Chạy go test -update để ghi lại kết quả.
+func TestLoginPageGolden(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join("testdata", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("no pages in testdata")
+	}
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".html")
+		t.Run(name, func(t *testing.T) {
+			body, err := os.ReadFile(page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sb strings.Builder
+			token, err := ParseCSRFToken(string(body))
+			fmt.Fprintf(&sb, "csrf_token: %s\n", result(token, err))
+			fmt.Fprintf(&sb, "login: %s\n", result("ok", CheckLoginResponse(http.StatusOK, string(body))))
+			got := sb.String()
+
+			golden := strings.TrimSuffix(page, ".html") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file, run go test -update: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("%s mismatch\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func result(value string, err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return value
+}
+
+func TestLoginPageErrors(t *testing.T) {
+	cases := []struct {
+		page string
+		csrf error
+		post error
+	}{
+		{"login_page", nil, ErrUnexpectedPage},
+		{"login_page_script_only", nil, ErrUnexpectedPage},
+		{"wrong_password", nil, ErrInvalidCredentials},
+		{"wrong_password_vi", nil, ErrInvalidCredentials},
+		{"too_many_attempts", nil, ErrAccountLocked},
+		{"web_client", nil, nil},
+		{"maintenance", ErrCSRFNotFound, nil},
+	}
+	for _, c := range cases {
+		body, err := os.ReadFile(filepath.Join("testdata", c.page+".html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseCSRFToken(string(body)); !errors.Is(err, c.csrf) {
+			t.Errorf("%s: ParseCSRFToken error = %v, want %v", c.page, err, c.csrf)
+		}
+		if err := CheckLoginResponse(http.StatusOK, string(body)); !errors.Is(err, c.post) {
+			t.Errorf("%s: CheckLoginResponse error = %v, want %v", c.page, err, c.post)
+		}
+	}
+	if err := CheckLoginResponse(http.StatusBadRequest, ""); !errors.Is(err, ErrUnexpectedPage) {
+		t.Errorf("http 400: got %v, want ErrUnexpectedPage", err)
+	}
+}
@@ -0,0 +1,98 @@
+package login
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/metrics"
+
+	"resty.dev/v3"
+)
+
+// Tham số TOTP mặc định của Odoo (RFC 6238): HMAC-SHA1, bước 30 giây, 6 chữ số
+const (
+	totpStep   = 30 * time.Second
+	totpDigits = 6
+)
+
+type totpSecretKey struct{}
+
+// WithTOTPSecret truyền secret TOTP (base32) của user cho DoLogin, dùng khi Odoo bật xác thực hai lớp
+func WithTOTPSecret(ctx context.Context, secret string) context.Context {
+	return context.WithValue(ctx, totpSecretKey{}, secret)
+}
+
+func totpSecret(ctx context.Context) string {
+	v, _ := ctx.Value(totpSecretKey{}).(string)
+	return v
+}
+
+// TOTPCode tính mã TOTP tại thời điểm t từ secret base32, chấp nhận chữ thường, khoảng trắng và thiếu padding
+func TOTPCode(secret string, t time.Time) (string, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	normalized = strings.TrimRight(normalized, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+	if err != nil || len(key) == 0 {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTOTPSecret, err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(totpStep/time.Second)))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
+
+// completeTOTP gửi mã TOTP cho form xác thực hai lớp bằng cùng resty client (cookie jar giữ phiên đăng nhập dở dang)
+func completeTOTP(ctx context.Context, logger *elog.Logger, restyClient *resty.Client, settings config.ERPConfig, username string, challenge TOTPChallenge) (*resty.Response, error) {
+	secret := totpSecret(ctx)
+	if secret == "" {
+		return nil, ErrTOTPRequired
+	}
+	code, err := TOTPCode(secret, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	totpUrl := settings.BaseURL + erp.TOTP_PREFIX_URL
+	if strings.HasPrefix(challenge.Action, "/") {
+		totpUrl = settings.Origin() + challenge.Action
+	}
+	logger.Debug("totp challenge", elog.Fields{"user": username, "url": totpUrl})
+
+	if err := erp.Wait(ctx); err != nil {
+		return nil, err
+	}
+	requestStart := time.Now()
+	resp, err := restyClient.R().
+		SetContext(ctx).
+		SetFormData(map[string]string{
+			"csrf_token": challenge.CsrfToken,
+			"totp_token": code,
+		}).
+		SetContentType("application/x-www-form-urlencoded").
+		Post(totpUrl)
+	metrics.ObserveERPRequest(erp.TOTP_PREFIX_URL, http.MethodPost, requestStart)
+	if err != nil {
+		logger.Error("error posting totp form", elog.Fields{"err": err, "user": username})
+		return nil, err
+	}
+	if err := CheckTOTPResponse(resp.StatusCode(), resp.String()); err != nil {
+		return nil, err
+	}
+	logger.Info("totp verified", elog.F("user", username))
+	return resp, nil
+}
@@ -0,0 +1,136 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/internal/config"
+)
+
+// Secret của vector kiểm thử RFC 6238 ("12345678901234567890" dạng base32)
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range tests {
+		got, err := TOTPCode(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("t=%d: got %s, want %s", unix, got, want)
+		}
+	}
+	if got, _ := TOTPCode("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0)); got != "287082" {
+		t.Errorf("lower case secret with spaces: got %s", got)
+	}
+	if _, err := TOTPCode("not base32!", time.Now()); err == nil {
+		t.Error("expected error for invalid secret")
+	}
+}
+
+// fakeTOTPOdoo giả lập Odoo bật 2FA: đúng mật khẩu thì chuyển sang /web/login/totp,
+// chỉ cấp session đã xác thực khi mã TOTP khớp với rfcSecret.
+func fakeTOTPOdoo(t *testing.T) *httptest.Server {
+	page := func(name string) []byte {
+		body, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /web/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "anonymous", Path: "/"})
+		_, _ = w.Write(page("login_page.html"))
+	})
+	mux.HandleFunc("POST /web/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("login") != "duydv@ngs.com.vn" || r.FormValue("password") != "secret" {
+			_, _ = w.Write(page("wrong_password.html"))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "pre-auth", Path: "/"})
+		http.Redirect(w, r, "/web/login/totp", http.StatusSeeOther)
+	})
+	mux.HandleFunc("GET /web/login/totp", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(page("totp_challenge.html"))
+	})
+	mux.HandleFunc("POST /web/login/totp", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session_id"); err != nil || c.Value != "pre-auth" {
+			http.Redirect(w, r, "/web/login", http.StatusSeeOther)
+			return
+		}
+		now := time.Now()
+		accepted := false
+		for _, at := range []time.Time{now.Add(-totpStep), now, now.Add(totpStep)} {
+			if code, _ := TOTPCode(rfcSecret, at); code == r.FormValue("totp_token") {
+				accepted = true
+			}
+		}
+		if !accepted || r.FormValue("csrf_token") == "" {
+			_, _ = w.Write(page("totp_invalid.html"))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "authenticated", Path: "/", MaxAge: 3600})
+		http.Redirect(w, r, "/web", http.StatusSeeOther)
+	})
+	mux.HandleFunc("GET /web", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(page("web_client.html"))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestDoLoginTOTP(t *testing.T) {
+	srv := fakeTOTPOdoo(t)
+	defer srv.Close()
+
+	cfg := config.Default().ERP
+	cfg.BaseURL = srv.URL + "/web"
+	cfg.RequestsPerSecond = 0
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = erp.Configure(config.Default().ERP) }()
+	defer LOGIN_SESSION.Delete("duydv@ngs.com.vn")
+
+	tests := []struct {
+		name   string
+		secret string
+		want   error
+	}{
+		{"valid code", rfcSecret, nil},
+		{"no secret", "", ErrTOTPRequired},
+		{"wrong secret", "JBSWY3DPEHPK3PXP", ErrTOTPInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			LOGIN_SESSION.Delete("duydv@ngs.com.vn")
+			ctx := WithTOTPSecret(context.Background(), tt.secret)
+			err := DoLogin(ctx, "duydv@ngs.com.vn", "secret")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			v, ok := LOGIN_SESSION.Load("duydv@ngs.com.vn")
+			if tt.want != nil {
+				if ok {
+					t.Error("session stored after failed two-factor step")
+				}
+				return
+			}
+			if !ok || v.(*Session).SessionId != "authenticated" {
+				t.Errorf("expected authenticated session, got %v", v)
+			}
+		})
+	}
+}
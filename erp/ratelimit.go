@@ -0,0 +1,73 @@
+package erp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket cho phép trung bình rate request mỗi giây, tối đa burst request liền nhau
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+var limiter = &tokenBucket{}
+
+// setRate đổi tốc độ của limiter, rate <= 0 là không giới hạn. Token hiện có được giữ lại trong giới hạn burst mới.
+func (b *tokenBucket) setRate(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() || b.rate <= 0 {
+		b.tokens = float64(burst)
+	}
+	b.rate = rate
+	b.burst = float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// reserve lấy một token và trả về thời gian phải chờ trước khi được gửi request
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Wait chờ đến lượt gửi một request tới ERP theo erp.requestsPerSecond và erp.requestBurst.
+// Trả về lỗi của ctx nếu ctx kết thúc trước.
+func Wait(ctx context.Context) error {
+	d := limiter.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
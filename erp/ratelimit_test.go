@@ -0,0 +1,38 @@
+package erp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := &tokenBucket{}
+	b.setRate(2, 2)
+	now := time.Date(2025, 11, 28, 8, 0, 0, 0, time.UTC)
+
+	// burst đi ngay, request thứ ba chờ 1/rate
+	for i := 0; i < 2; i++ {
+		if d := b.reserve(now); d != 0 {
+			t.Fatalf("request %d waited %v within burst", i, d)
+		}
+	}
+	if d := b.reserve(now); d != 500*time.Millisecond {
+		t.Fatalf("third request waits %v, want 500ms", d)
+	}
+
+	// sau 2 giây bucket đầy lại nhưng không vượt burst
+	now = now.Add(2 * time.Second)
+	for i := 0; i < 2; i++ {
+		if d := b.reserve(now); d != 0 {
+			t.Fatalf("request %d after refill waited %v", i, d)
+		}
+	}
+	if d := b.reserve(now); d == 0 {
+		t.Fatal("bucket refilled beyond burst")
+	}
+
+	b.setRate(0, 0)
+	if d := b.reserve(now); d != 0 {
+		t.Fatalf("unlimited rate waited %v", d)
+	}
+}
@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/leader"
+	"go-ngsc-erp/internal/metrics"
+	"go-ngsc-erp/internal/notify"
+	"go-ngsc-erp/server"
+)
+
+const serviceName = "go-ngsc-erp"
+
+type command struct {
+	name  string
+	usage string
+	run   func(env *environment, args []string) error
+}
+
+// environment là cấu hình đã nạp, dùng chung cho mọi lệnh
+type environment struct {
+	configPath string
+	cfg        config.Config
+	stdout     io.Writer
+}
+
+var commands = []command{
+	{"serve", "serve", runServe},
+	{"login-test", "login-test <user>", runLoginTest},
+	{"checkin", "checkin [--dry-run] [--force] <user>", runAction("CHECKIN")},
+	{"checkout", "checkout [--dry-run] [--force] <user>", runAction("CHECKOUT")},
+	{"users", "users list | users add --username u --user-id n --arg-id n [--password p] [--instance name] [--totp-secret s] [--notify-webhook url] | users remove <user>", runUsers},
+	{"jobs", "jobs list [--server url]", runJobs},
+	{"stats", "stats [--user u]", runStats},
+	{"import-csv", "import-csv <file>", runImportCSV},
+	{"validate-config", "validate-config", runValidateConfig},
+}
+
+// Run chạy lệnh theo args (không gồm tên chương trình) và trả về exit code. Không có lệnh thì chạy serve.
+func Run(args []string) int {
+	global := flag.NewFlagSet(serviceName, flag.ContinueOnError)
+	configPath := global.String("config", "", "config file (default $CONFIG_FILE or ./config.yaml)")
+	global.Usage = func() { printUsage(global.Output()) }
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	args = global.Args()
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		env := &environment{configPath: config.Path(*configPath), stdout: os.Stdout}
+		if c.name != "validate-config" {
+			cfg, err := setup(env.configPath, c.name == "serve")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return 1
+			}
+			env.cfg = cfg
+		}
+		if err := c.run(env, args); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	printUsage(os.Stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s [--config file] <command>\n\ncommands:\n", serviceName)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\n", c.usage)
+	}
+}
+
+// setup nạp cấu hình và khởi tạo elog, erp, app. Daemon ghi log theo log.sinks,
+// các lệnh một lần ghi log dạng text ra stderr để stdout chỉ chứa kết quả.
+func setup(configPath string, daemon bool) (config.Config, error) {
+	// Đọc cấu hình từ file và biến môi trường
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Initialize structured logger. LOG_LEVEL env var still overrides log.level.
+	var sinkOpts []elog.Option
+	if daemon {
+		sinkOpts, err = logSinks(cfg.Log.Sinks)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to configure log sinks: %w", err)
+		}
+	} else {
+		stderr := &elog.ConsoleSink{Format: elog.FormatText, Out: os.Stderr, Err: os.Stderr}
+		sinkOpts = []elog.Option{elog.WithSink(stderr, elog.LevelDebug)}
+	}
+	_ = elog.Init(cfg.Log.Level, serviceName, sinkOpts...)
+	elog.AddDenyFields(cfg.Log.RedactFields...)
+	elog.SetRecentSize(cfg.Log.RecentSize)
+
+	if err := erp.Configure(cfg.ERP); err != nil {
+		return cfg, fmt.Errorf("failed to configure erp client: %w", err)
+	}
+	if err := app.Configure(cfg.Schedule, cfg.Store); err != nil {
+		return cfg, fmt.Errorf("failed to configure scheduler: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadUsers đọc danh sách user từ store.usersFile. Chưa cấu hình file thì bắt đầu với danh sách rỗng,
+// user được thêm qua POST /upload và chỉ giữ trong bộ nhớ.
+func loadUsers(cfg config.Config) ([]app.UserCredentials, error) {
+	if cfg.Store.UsersFile == "" {
+		elog.Warn("store.usersFile is not configured, starting with no users", nil)
+		return nil, nil
+	}
+	return app.LoadUsersFile(cfg.Store.UsersFile)
+}
+
+func runServe(env *environment, args []string) error {
+	cfg := env.cfg
+	users, err := loadUsers(cfg)
+	if err != nil {
+		return err
+	}
+	if err := app.CheckUserInstances(cfg.ERP, users); err != nil {
+		return err
+	}
+
+	// Đưa dữ liệu từ slice vào USER_STORE
+	for _, u := range users {
+		app.USER_STORE.Store(u.Username, u)
+		elog.Info("Added user"+u.Username, elog.F("user", u))
+	}
+
+	// Kênh gửi bản tổng hợp cuối ngày: digest.channel=log|webhook, digest.webhookUrl cho webhook
+	digestNotifier, err := notify.New(cfg.Digest.Channel, cfg.Digest.WebhookURL)
+	if err != nil {
+		return fmt.Errorf("failed to configure digest notifier: %w", err)
+	}
+	app.SetDigestNotifier(digestNotifier)
+
+	metrics.RegisterGaugeFunc("login_sessions_active", "Login sessions in LOGIN_SESSION that have not expired.", func() float64 {
+		return float64(login.ActiveSessionCount())
+	})
+	metrics.RegisterGaugeFunc("user_store_size", "Users loaded in USER_STORE.", func() float64 {
+		return float64(app.UserCount())
+	})
+	metrics.RegisterGaugeFunc("users_credentials_rejected", "Users whose scheduled actions are paused because the ERP rejected their credentials.", func() float64 {
+		return float64(app.SuppressedUserCount())
+	})
+	metrics.RegisterGaugeFunc("csv_writer_queue_depth", "Attendance logs waiting to be written to CSV.", func() float64 {
+		return float64(len(app.CsvWriterChan))
+	})
+
+	metrics.RegisterGaugeFunc("action_queue_depth", "Attendance actions waiting for a worker.", func() float64 {
+		return float64(app.ActionQueueDepth())
+	})
+	metrics.RegisterGaugeFunc("actions_in_progress", "Attendance actions being run by workers.", func() float64 {
+		return float64(app.ActionsRunning())
+	})
+
+	go app.WaitForWritingLog()
+	app.StartWorkers(cfg.ERP.MaxConcurrentActions)
+	if err := runScheduler(cfg.Leader); err != nil {
+		return err
+	}
+
+	app.InitReload(env.configPath, cfg)
+	if cfg.Reload.Watch {
+		go app.WatchConfig(time.Duration(cfg.Reload.IntervalSeconds) * time.Second)
+	}
+
+	server.StartServer(cfg)
+	return nil
+}
+
+// logSinks tạo các sink của elog theo log.sinks, mỗi sink có level riêng (mặc định debug)
+func logSinks(sinks []config.LogSinkConfig) ([]elog.Option, error) {
+	opts := make([]elog.Option, 0, len(sinks))
+	for _, s := range sinks {
+		level := elog.LevelDebug
+		if s.Level != "" {
+			level = elog.ParseLevel(s.Level)
+		}
+		switch s.Type {
+		case "console":
+			opts = append(opts, elog.WithSink(elog.NewConsoleSink(s.Format), level))
+		case "file":
+			fileSink, err := elog.NewFileSink(s.Path, s.Format, int64(s.MaxSizeMB)*1024*1024, s.MaxBackups)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, elog.WithSink(fileSink, level))
+		}
+	}
+	return opts, nil
+}
+
+// runScheduler chạy scheduler ngay nếu không bầu leader, ngược lại chỉ chạy khi instance là leader
+func runScheduler(cfg config.LeaderConfig) error {
+	elector, err := leader.New(leader.Config{
+		Backend:       cfg.Backend,
+		LockFile:      cfg.LockFile,
+		LeaseName:     cfg.LeaseName,
+		Namespace:     cfg.Namespace,
+		Identity:      cfg.Identity,
+		LeaseDuration: time.Duration(cfg.LeaseDurationSeconds) * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure leader election: %w", err)
+	}
+	if elector == nil {
+		app.RunJob()
+		return nil
+	}
+	metrics.RegisterGaugeFunc("leader", "1 when this instance runs the scheduler.", func() float64 {
+		if leader.IsLeader() {
+			return 1
+		}
+		return 0
+	})
+	go leader.Run(context.Background(), elector, time.Duration(cfg.RenewIntervalSeconds)*time.Second, app.TakeOverJob, app.StopJob)
+	return nil
+}
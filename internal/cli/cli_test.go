@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/internal/config"
+)
+
+func TestUsersAddAndRemove(t *testing.T) {
+	cfg := config.Default()
+	cfg.Store.UsersFile = filepath.Join(t.TempDir(), "users.json")
+	env := &environment{cfg: cfg, stdout: &bytes.Buffer{}}
+
+	if err := runUsers(env, []string{"add", "--username", "a@ngs.com.vn", "--password", "pw", "--user-id", "1", "--arg-id", "2"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := runUsers(env, []string{"add", "--username", "a@ngs.com.vn", "--password", "pw2", "--user-id", "1", "--arg-id", "3"}); err != nil {
+		t.Fatalf("add again: %v", err)
+	}
+	users, err := app.LoadUsersFile(cfg.Store.UsersFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ArgId != 3 || users[0].Password != "pw2" {
+		t.Fatalf("users = %+v, want one replaced entry", users)
+	}
+
+	if err := runUsers(env, []string{"remove", "a@ngs.com.vn"}); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := runUsers(env, []string{"remove", "a@ngs.com.vn"}); err == nil {
+		t.Fatal("removing a missing user should fail")
+	}
+}
+
+func TestImportCSVSkipsDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "old.csv")
+	rows := "Username,Action,ActionTime,ErrorDetail,Status\n" +
+		"a,CHECKIN,2026-10-19T08:00:00+07:00,,ATTENDANCE SUCCESS\n" +
+		"a,CHECKOUT,2026-10-19T17:45:00+07:00,,ATTENDANCE SUCCESS\n"
+	if err := os.WriteFile(src, []byte(rows), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := app.CsvPath
+	app.CsvPath = filepath.Join(dir, "attendance.csv")
+	defer func() { app.CsvPath = old }()
+
+	out := &bytes.Buffer{}
+	env := &environment{cfg: config.Default(), stdout: out}
+	for i := 0; i < 2; i++ {
+		if err := runImportCSV(env, []string{src}); err != nil {
+			t.Fatalf("import %d: %v", i, err)
+		}
+	}
+	if !strings.Contains(out.String(), "imported 0 rows") {
+		t.Fatalf("second import should skip everything, got %q", out.String())
+	}
+	logs, err := app.ReadCSVAndMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("got %d rows, want 2", len(logs))
+	}
+}
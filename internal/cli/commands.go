@@ -0,0 +1,358 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/config"
+)
+
+var errUsage = errors.New("invalid arguments")
+
+// findUser tìm user theo username trong danh sách user đã cấu hình
+func findUser(cfg config.Config, username string) (app.UserCredentials, error) {
+	users, err := loadUsers(cfg)
+	if err != nil {
+		return app.UserCredentials{}, err
+	}
+	for _, u := range users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return app.UserCredentials{}, fmt.Errorf("user %s not found", username)
+}
+
+func runLoginTest(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: usage: login-test <user>", errUsage)
+	}
+	user, err := findUser(env.cfg, args[0])
+	if err != nil {
+		return err
+	}
+	ctx := login.WithTOTPSecret(erp.WithInstance(context.Background(), user.Instance), user.TOTPSecret)
+	if err := login.DoLogin(ctx, user.Username, user.Password); err != nil {
+		return fmt.Errorf("login failed for %s: %w", user.Username, err)
+	}
+	fmt.Fprintf(env.stdout, "login OK for %s\n", user.Username)
+	return nil
+}
+
+// runAction chấm công ngay cho một user, kết quả vẫn được ghi vào file CSV như khi chạy theo lịch
+func runAction(action string) func(env *environment, args []string) error {
+	return func(env *environment, args []string) error {
+		fs := flag.NewFlagSet(strings.ToLower(action), flag.ContinueOnError)
+		dryRun := fs.Bool("dry-run", env.cfg.ERP.DryRun, "log the attendance request instead of sending it")
+		force := fs.Bool("force", false, "run even if the action already succeeded today")
+		if err := fs.Parse(args); err != nil {
+			return errUsage
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("%w: usage: %s [--dry-run] [--force] <user>", errUsage, strings.ToLower(action))
+		}
+		user, err := findUser(env.cfg, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		go app.WaitForWritingLog()
+		ctx := erp.WithDryRun(context.Background(), *dryRun)
+		if *force {
+			ctx = app.WithForce(ctx)
+		}
+		result := app.DoAction(ctx, action, user)
+		app.StopLogWriter()
+
+		fmt.Fprintf(env.stdout, "%s %s: %s\n", result.Username, result.Action, result.Status)
+		if result.Status == app.StatusFailed {
+			return errors.New(result.ErrorDetail)
+		}
+		return nil
+	}
+}
+
+func runUsers(env *environment, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: usage: users list|add|remove", errUsage)
+	}
+	switch args[0] {
+	case "list":
+		users, err := loadUsers(env.cfg)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "USERNAME\tINSTANCE\tUSER ID\tARG ID")
+		for _, u := range users {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", u.Username, u.InstanceName(), u.UserId, u.ArgId)
+		}
+		return tw.Flush()
+	case "add":
+		return addUser(env, args[1:])
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("%w: usage: users remove <user>", errUsage)
+		}
+		return removeUser(env, args[1])
+	}
+	return fmt.Errorf("%w: unknown users subcommand %q", errUsage, args[0])
+}
+
+// usersFile trả về store.usersFile, chỉ file này mới sửa được từ CLI
+func usersFile(cfg config.Config) (string, error) {
+	if cfg.Store.UsersFile == "" {
+		return "", errors.New("store.usersFile is not configured")
+	}
+	return cfg.Store.UsersFile, nil
+}
+
+func addUser(env *environment, args []string) error {
+	fs := flag.NewFlagSet("users add", flag.ContinueOnError)
+	username := fs.String("username", "", "ERP login")
+	password := fs.String("password", "", "ERP password (read from stdin when empty)")
+	userID := fs.Int("user-id", 0, "ERP user id")
+	argID := fs.Int("arg-id", 0, "ERP employee id used by attendance")
+	instance := fs.String("instance", "", "ERP instance from erp.instances (default instance when empty)")
+	totpSecret := fs.String("totp-secret", "", "base32 TOTP secret when the account has two-factor authentication")
+	notifyWebhook := fs.String("notify-webhook", "", "owner's incoming webhook for rejected-login alerts")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *username == "" || *userID == 0 || *argID == 0 {
+		return fmt.Errorf("%w: --username, --user-id and --arg-id are required", errUsage)
+	}
+
+	path, err := usersFile(env.cfg)
+	if err != nil {
+		return err
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+		if *password == "" {
+			return errors.New("password is required")
+		}
+	}
+
+	users, err := existingUsers(path)
+	if err != nil {
+		return err
+	}
+	if *totpSecret != "" {
+		if _, err := login.TOTPCode(*totpSecret, time.Now()); err != nil {
+			return err
+		}
+	}
+	user := app.UserCredentials{Username: *username, Password: *password, UserId: *userID, ArgId: *argID, Instance: *instance, TOTPSecret: *totpSecret, NotifyWebhook: *notifyWebhook}
+	if err := app.CheckUserInstances(env.cfg.ERP, []app.UserCredentials{user}); err != nil {
+		return err
+	}
+	replaced := false
+	for i, u := range users {
+		if u.Username == user.Username {
+			users[i] = user
+			replaced = true
+		}
+	}
+	if !replaced {
+		users = append(users, user)
+	}
+	if err := app.SaveUsersFile(path, users); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.stdout, "saved %s to %s\n", user.Username, path)
+	return nil
+}
+
+func removeUser(env *environment, username string) error {
+	path, err := usersFile(env.cfg)
+	if err != nil {
+		return err
+	}
+	users, err := existingUsers(path)
+	if err != nil {
+		return err
+	}
+	kept := make([]app.UserCredentials, 0, len(users))
+	for _, u := range users {
+		if u.Username != username {
+			kept = append(kept, u)
+		}
+	}
+	if len(kept) == len(users) {
+		return fmt.Errorf("user %s not found in %s", username, path)
+	}
+	if err := app.SaveUsersFile(path, kept); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.stdout, "removed %s from %s\n", username, path)
+	return nil
+}
+
+// existingUsers đọc users file, file chưa tồn tại được coi là danh sách rỗng
+func existingUsers(path string) ([]app.UserCredentials, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return app.LoadUsersFile(path)
+}
+
+// runJobs lấy danh sách job từ daemon đang chạy qua GET /jobs, vì scheduler chỉ tồn tại trong tiến trình serve
+func runJobs(env *environment, args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return fmt.Errorf("%w: usage: jobs list [--server url]", errUsage)
+	}
+	fs := flag.NewFlagSet("jobs list", flag.ContinueOnError)
+	serverURL := fs.String("server", serverBaseURL(env.cfg.Server.Addr), "base URL of the running daemon")
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimRight(*serverURL, "/") + "/jobs")
+	if err != nil {
+		return fmt.Errorf("failed to reach daemon: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("daemon returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var jobs []app.JobInfo
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		return fmt.Errorf("failed to decode jobs: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tNAME\tUSER\tACTION\tSTATE\tNEXT RUN")
+	for _, j := range jobs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", j.ID, j.Kind, j.Name, j.Username, j.Action, j.State, j.NextRun.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// serverBaseURL đổi server.addr dạng ":8080" thành URL gọi được từ cùng máy
+func serverBaseURL(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return "http://" + addr
+}
+
+func runStats(env *environment, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	onlyUser := fs.String("user", "", "only count logs of this user")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	logs, err := app.ReadCSVAndMap()
+	if err != nil {
+		return err
+	}
+
+	statuses := []string{app.StatusSuccess, app.StatusFailed, app.StatusSkipped, app.StatusDryRun}
+	counts := make(map[string]map[string]int)
+	for _, l := range logs {
+		if *onlyUser != "" && l.Username != *onlyUser {
+			continue
+		}
+		if counts[l.Username] == nil {
+			counts[l.Username] = make(map[string]int)
+		}
+		counts[l.Username][l.Status]++
+	}
+	usernames := make([]string, 0, len(counts))
+	for u := range counts {
+		usernames = append(usernames, u)
+	}
+	sort.Strings(usernames)
+
+	tw := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tSUCCESS\tFAILED\tSKIPPED\tDRY RUN\tTOTAL")
+	for _, u := range usernames {
+		total := 0
+		for _, n := range counts[u] {
+			total += n
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", u, counts[u][statuses[0]], counts[u][statuses[1]], counts[u][statuses[2]], counts[u][statuses[3]], total)
+	}
+	return tw.Flush()
+}
+
+// runImportCSV nối các dòng của một file log khác vào CsvPath, bỏ qua dòng đã có (cùng user, action và thời gian)
+func runImportCSV(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: usage: import-csv <file>", errUsage)
+	}
+	incoming, err := app.ReadCSVFile(args[0])
+	if err != nil {
+		return err
+	}
+	existing, err := app.ReadCSVAndMap()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	key := func(l app.CsvAttendanceLog) string {
+		return l.Username + "|" + l.Action + "|" + l.ActionTime.Format(app.TimeLayout)
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, l := range existing {
+		seen[key(l)] = true
+	}
+
+	writer, err := app.NewSyncCSVWriter(app.CsvPath, app.CsvHeader)
+	if err != nil {
+		return err
+	}
+	imported, skipped := 0, 0
+	for _, l := range incoming {
+		if seen[key(l)] {
+			skipped++
+			continue
+		}
+		if err := writer.WriteRow(l.Record()); err != nil {
+			return err
+		}
+		seen[key(l)] = true
+		imported++
+	}
+	fmt.Fprintf(env.stdout, "imported %d rows into %s, skipped %d duplicates\n", imported, app.CsvPath, skipped)
+	return nil
+}
+
+func runValidateConfig(env *environment, args []string) error {
+	cfg, err := config.Load(env.configPath)
+	if err != nil {
+		return err
+	}
+	users, err := loadUsers(cfg)
+	if err != nil {
+		return err
+	}
+	if err := app.CheckUserInstances(cfg.ERP, users); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.stdout, "config %s OK: %d users, %d erp instances, morning %q, evening %q, timezone %s\n",
+		env.configPath, len(users), len(cfg.ERP.InstanceNames()), cfg.Schedule.DailyMorningCron, cfg.Schedule.DailyEveningCron, cfg.Schedule.Timezone)
+	return nil
+}
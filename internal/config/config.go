@@ -0,0 +1,664 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Env chứa đường dẫn file cấu hình, mặc định là DefaultFile nếu file tồn tại
+const EnvConfigFile = "CONFIG_FILE"
+const DefaultFile = "./config.yaml"
+
+const redacted = "***"
+
+// Cách đăng nhập ERP: form HTML /web/login hoặc JSON-RPC /web/session/authenticate
+const (
+	LoginMethodForm    = "form"
+	LoginMethodJSONRPC = "jsonrpc"
+)
+
+// DefaultInstance là tên của ERP khai báo trực tiếp trong erp.*, dùng cho user không chọn instance
+const DefaultInstance = "default"
+
+type Config struct {
+	Server   ServerConfig   `json:"server" yaml:"server"`
+	Log      LogConfig      `json:"log" yaml:"log"`
+	ERP      ERPConfig      `json:"erp" yaml:"erp"`
+	Schedule ScheduleConfig `json:"schedule" yaml:"schedule"`
+	Store    StoreConfig    `json:"store" yaml:"store"`
+	Digest   DigestConfig   `json:"digest" yaml:"digest"`
+	Reload   ReloadConfig   `json:"reload" yaml:"reload"`
+	Leader   LeaderConfig   `json:"leader" yaml:"leader"`
+	Portal   PortalConfig   `json:"portal" yaml:"portal"`
+}
+
+type ServerConfig struct {
+	Addr string `json:"addr" yaml:"addr"`
+}
+
+type LogConfig struct {
+	Level string `json:"level" yaml:"level"`
+	// RedactFields bổ sung tên field bị ẩn giá trị, ngoài danh sách mặc định của elog
+	RedactFields []string `json:"redactFields" yaml:"redactFields"`
+	// Sinks rỗng thì ghi JSON ra console như trước
+	Sinks []LogSinkConfig `json:"sinks" yaml:"sinks"`
+	// RecentSize là số log gần nhất giữ trong bộ nhớ cho /admin/logs
+	RecentSize int `json:"recentSize" yaml:"recentSize"`
+}
+
+// LogSinkConfig mô tả một đích ghi log: console hoặc file (có xoay vòng).
+// Log gần nhất trong bộ nhớ cho /admin/logs cấu hình bằng log.recentSize.
+type LogSinkConfig struct {
+	Type       string `json:"type" yaml:"type"`
+	Format     string `json:"format" yaml:"format"`
+	Level      string `json:"level" yaml:"level"`
+	Path       string `json:"path" yaml:"path"`
+	MaxSizeMB  int    `json:"maxSizeMb" yaml:"maxSizeMb"`
+	MaxBackups int    `json:"maxBackups" yaml:"maxBackups"`
+}
+
+type ERPConfig struct {
+	BaseURL    string  `json:"baseUrl" yaml:"baseUrl"`
+	Lang       string  `json:"lang" yaml:"lang"`
+	Timezone   string  `json:"timezone" yaml:"timezone"`
+	CompanyIDs []int   `json:"companyIds" yaml:"companyIds"`
+	Latitude   float64 `json:"latitude" yaml:"latitude"`
+	Longitude  float64 `json:"longitude" yaml:"longitude"`
+	LocationID string  `json:"locationId" yaml:"locationId"`
+	// LoginMethod là form (mặc định) hoặc jsonrpc; jsonrpc cần Database
+	LoginMethod string `json:"loginMethod" yaml:"loginMethod"`
+	Database    string `json:"database" yaml:"database"`
+	// DryRun chạy mọi bước trừ request chấm công, log DataJSON và ghi trạng thái DRY_RUN
+	DryRun bool `json:"dryRun" yaml:"dryRun"`
+	// Số action (đăng nhập + chấm công) chạy đồng thời, action vượt quá được xếp hàng đợi
+	MaxConcurrentActions int `json:"maxConcurrentActions" yaml:"maxConcurrentActions"`
+	// Giới hạn request tới ERP theo token bucket, RequestsPerSecond <= 0 là không giới hạn
+	RequestsPerSecond float64    `json:"requestsPerSecond" yaml:"requestsPerSecond"`
+	RequestBurst      int        `json:"requestBurst" yaml:"requestBurst"`
+	HTTP              HTTPConfig `json:"http" yaml:"http"`
+	// Instances là các ERP (database hoặc company) khác ngoài erp.* mặc định, user chọn qua field instance
+	Instances []ERPInstance `json:"instances" yaml:"instances"`
+}
+
+// ERPInstance là một ERP được đặt tên; field bỏ trống lấy theo erp.*.
+// Transport, rate limit, dry-run và số action đồng thời luôn dùng chung của erp.*.
+type ERPInstance struct {
+	Name        string  `json:"name" yaml:"name"`
+	BaseURL     string  `json:"baseUrl" yaml:"baseUrl"`
+	LoginMethod string  `json:"loginMethod" yaml:"loginMethod"`
+	Database    string  `json:"database" yaml:"database"`
+	CompanyIDs  []int   `json:"companyIds" yaml:"companyIds"`
+	Timezone    string  `json:"timezone" yaml:"timezone"`
+	Lang        string  `json:"lang" yaml:"lang"`
+	Latitude    float64 `json:"latitude" yaml:"latitude"`
+	Longitude   float64 `json:"longitude" yaml:"longitude"`
+	LocationID  string  `json:"locationId" yaml:"locationId"`
+}
+
+// HTTPConfig cấu hình transport dùng chung cho mọi request tới ERP
+type HTTPConfig struct {
+	// TimeoutSeconds giới hạn mỗi request, kể cả đọc body
+	TimeoutSeconds         int `json:"timeoutSeconds" yaml:"timeoutSeconds"`
+	DialTimeoutSeconds     int `json:"dialTimeoutSeconds" yaml:"dialTimeoutSeconds"`
+	KeepAliveSeconds       int `json:"keepAliveSeconds" yaml:"keepAliveSeconds"`
+	IdleConnTimeoutSeconds int `json:"idleConnTimeoutSeconds" yaml:"idleConnTimeoutSeconds"`
+	MaxIdleConns           int `json:"maxIdleConns" yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost    int `json:"maxIdleConnsPerHost" yaml:"maxIdleConnsPerHost"`
+	// ProxyURL rỗng thì dùng HTTPS_PROXY/HTTP_PROXY của môi trường
+	ProxyURL string `json:"proxyUrl" yaml:"proxyUrl"`
+	// CAFile là file PEM bổ sung vào CA hệ thống, dùng khi ERP hoặc proxy dùng chứng chỉ nội bộ
+	CAFile string `json:"caFile" yaml:"caFile"`
+}
+
+type ScheduleConfig struct {
+	Timezone               string `json:"timezone" yaml:"timezone"`
+	DailyMorningCron       string `json:"dailyMorningCron" yaml:"dailyMorningCron"`
+	DailyEveningCron       string `json:"dailyEveningCron" yaml:"dailyEveningCron"`
+	MaxMorningDelayMinutes int    `json:"maxMorningDelayMinutes" yaml:"maxMorningDelayMinutes"`
+	MaxEveningDelayMinutes int    `json:"maxEveningDelayMinutes" yaml:"maxEveningDelayMinutes"`
+	// CredentialCheckCron là lịch thử đăng nhập mọi user ngoài giờ làm việc để phát hiện mật khẩu đã đổi, rỗng là tắt
+	CredentialCheckCron string `json:"credentialCheckCron" yaml:"credentialCheckCron"`
+	// Holidays là các ngày nghỉ (YYYY-MM-DD theo Timezone), routine sáng/chiều không lên lịch chấm công vào các ngày này
+	Holidays []string `json:"holidays,omitempty" yaml:"holidays"`
+}
+
+// HolidayLayout là định dạng ngày trong schedule.holidays
+const HolidayLayout = "2006-01-02"
+
+type StoreConfig struct {
+	CsvPath   string `json:"csvPath" yaml:"csvPath"`
+	UsersFile string `json:"usersFile" yaml:"usersFile"`
+	// IdempotencyFile lưu các action đã chấm công trong ngày, đặt trên volume dùng chung khi chạy nhiều replica; rỗng là chỉ giữ trong bộ nhớ
+	IdempotencyFile string `json:"idempotencyFile" yaml:"idempotencyFile"`
+}
+
+type DigestConfig struct {
+	Channel    string `json:"channel" yaml:"channel"`
+	WebhookURL string `json:"webhookUrl" yaml:"webhookUrl"`
+}
+
+// ReloadConfig điều khiển việc theo dõi file cấu hình và file user để áp dụng thay đổi khi đang chạy
+type ReloadConfig struct {
+	Watch           bool `json:"watch" yaml:"watch"`
+	IntervalSeconds int  `json:"intervalSeconds" yaml:"intervalSeconds"`
+}
+
+// LeaderConfig chọn cách bầu leader khi chạy nhiều replica: chỉ leader chạy scheduler,
+// mọi replica đều phục vụ HTTP API. Backend none (mặc định) coi instance luôn là leader.
+type LeaderConfig struct {
+	Backend   string `json:"backend" yaml:"backend"`
+	LockFile  string `json:"lockFile" yaml:"lockFile"`
+	LeaseName string `json:"leaseName" yaml:"leaseName"`
+	// Namespace rỗng thì dùng namespace của pod
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// Identity rỗng thì dùng POD_NAME hoặc hostname
+	Identity             string `json:"identity" yaml:"identity"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds" yaml:"leaseDurationSeconds"`
+	RenewIntervalSeconds int    `json:"renewIntervalSeconds" yaml:"renewIntervalSeconds"`
+}
+
+// PortalConfig cấu hình trang tự phục vụ /portal, nơi user đăng nhập bằng tài khoản ERP của mình.
+// Portal nhận mật khẩu ERP nên chỉ bật khi được phục vụ qua HTTPS (ingress/reverse proxy) cùng SecureCookie.
+type PortalConfig struct {
+	Enabled        bool `json:"enabled" yaml:"enabled"`
+	SessionMinutes int  `json:"sessionMinutes" yaml:"sessionMinutes"`
+	// SecureCookie bật cờ Secure cho cookie phiên, bắt buộc khi portal được phục vụ qua HTTPS
+	SecureCookie bool `json:"secureCookie" yaml:"secureCookie"`
+	// Số lần đăng nhập ERP thất bại tối đa trong LoginWindowMinutes theo username và theo IP,
+	// giữ dưới ngưỡng khóa tài khoản của Odoo để portal không bị dùng để khóa tài khoản người khác
+	MaxFailuresPerUser int `json:"maxFailuresPerUser" yaml:"maxFailuresPerUser"`
+	MaxFailuresPerIP   int `json:"maxFailuresPerIp" yaml:"maxFailuresPerIp"`
+	LoginWindowMinutes int `json:"loginWindowMinutes" yaml:"loginWindowMinutes"`
+	// TrustedProxies là các IP/CIDR của ingress hay reverse proxy. Chỉ request đi từ các địa chỉ này mới được
+	// lấy IP client từ X-Forwarded-For/X-Real-IP; bỏ trống thì giới hạn theo IP dùng địa chỉ kết nối.
+	TrustedProxies []string `json:"trustedProxies,omitempty" yaml:"trustedProxies"`
+}
+
+// ParseTrustedProxies chuyển portal.trustedProxies thành các dải mạng, IP đơn được coi là /32 hoặc /128
+func (c PortalConfig) ParseTrustedProxies() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, p := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(p); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("portal.trustedProxies: %q is not an ip or cidr", p)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Default trả về cấu hình mặc định, giống các hằng số trước đây trong erp, attendance, app và server
+func Default() Config {
+	return Config{
+		Server: ServerConfig{Addr: ":8080"},
+		Log:    LogConfig{Level: "info", RecentSize: 500},
+		ERP: ERPConfig{
+			BaseURL:              "https://erp-ngsc.com.vn/web",
+			Lang:                 "vi_VN",
+			Timezone:             "Asia/Saigon",
+			CompanyIDs:           []int{1},
+			Latitude:             21.051364,
+			Longitude:            105.799611,
+			LocationID:           "2",
+			LoginMethod:          LoginMethodForm,
+			MaxConcurrentActions: 4,
+			RequestsPerSecond:    2,
+			RequestBurst:         4,
+			HTTP: HTTPConfig{
+				TimeoutSeconds:         30,
+				DialTimeoutSeconds:     10,
+				KeepAliveSeconds:       30,
+				IdleConnTimeoutSeconds: 90,
+				MaxIdleConns:           20,
+				MaxIdleConnsPerHost:    10,
+			},
+		},
+		Schedule: ScheduleConfig{
+			Timezone:               "Asia/Ho_Chi_Minh",
+			DailyMorningCron:       "0 0 8 * * 1-5",
+			DailyEveningCron:       "0 45 17 * * 1-5",
+			MaxMorningDelayMinutes: 20,
+			MaxEveningDelayMinutes: 40,
+			CredentialCheckCron:    "0 0 6 * * *",
+		},
+		Store:  StoreConfig{CsvPath: "./attendance.csv", IdempotencyFile: "./idempotency.json"},
+		Digest: DigestConfig{Channel: "log"},
+		Reload: ReloadConfig{Watch: true, IntervalSeconds: 10},
+		Leader: LeaderConfig{
+			Backend:              "none",
+			LockFile:             "./scheduler.lock",
+			LeaseName:            "go-ngsc-erp-scheduler",
+			LeaseDurationSeconds: 15,
+			RenewIntervalSeconds: 5,
+		},
+		Portal: PortalConfig{SessionMinutes: 480, MaxFailuresPerUser: 3, MaxFailuresPerIP: 10, LoginWindowMinutes: 15},
+	}
+}
+
+// Path trả về đường dẫn file cấu hình: path nếu khác rỗng, sau đó CONFIG_FILE, cuối cùng DefaultFile
+func Path(path string) string {
+	if path == "" {
+		path = os.Getenv(EnvConfigFile)
+	}
+	if path == "" {
+		path = DefaultFile
+	}
+	return path
+}
+
+// Load đọc file cấu hình (YAML hoặc JSON theo phần mở rộng), áp dụng biến môi trường rồi validate.
+// path được xác định bằng Path; thiếu DefaultFile thì chỉ dùng giá trị mặc định.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	path = Path(path)
+	explicit := path != DefaultFile
+
+	raw, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := decode(path, raw, &cfg); err != nil {
+			return cfg, err
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	default:
+		return cfg, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+	// Level được so sánh khi reload và hiển thị ở GET /config nên lưu một cách viết duy nhất
+	cfg.Log.Level = strings.ToLower(cfg.Log.Level)
+	for i := range cfg.Log.Sinks {
+		cfg.Log.Sinks[i].Level = strings.ToLower(cfg.Log.Sinks[i].Level)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func decode(path string, raw []byte, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(raw, cfg); err != nil {
+			return fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(raw, cfg); err != nil {
+			return fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config format %s", path)
+	}
+	return nil
+}
+
+// applyEnv ghi đè cấu hình bằng biến môi trường, giữ tương thích với LOG_LEVEL và DIGEST_* cũ
+func applyEnv(cfg *Config) error {
+	setString := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			*dst = v
+		}
+	}
+	setInt := func(name string, dst *int) error {
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*dst = n
+		return nil
+	}
+
+	setString("LISTEN_ADDR", &cfg.Server.Addr)
+	setString("LOG_LEVEL", &cfg.Log.Level)
+	setString("ERP_BASE_URL", &cfg.ERP.BaseURL)
+	setString("ERP_LANG", &cfg.ERP.Lang)
+	setString("ERP_TIMEZONE", &cfg.ERP.Timezone)
+	setString("ERP_LOGIN_METHOD", &cfg.ERP.LoginMethod)
+	setString("ERP_DATABASE", &cfg.ERP.Database)
+	if v := os.Getenv("ERP_COMPANY_IDS"); v != "" {
+		ids, err := parseIntList(v)
+		if err != nil {
+			return fmt.Errorf("invalid ERP_COMPANY_IDS: %w", err)
+		}
+		cfg.ERP.CompanyIDs = ids
+	}
+	if v := os.Getenv("ERP_DRY_RUN"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid ERP_DRY_RUN: %w", err)
+		}
+		cfg.ERP.DryRun = dryRun
+	}
+	if err := setInt("ERP_MAX_CONCURRENT_ACTIONS", &cfg.ERP.MaxConcurrentActions); err != nil {
+		return err
+	}
+	if v := os.Getenv("ERP_REQUESTS_PER_SECOND"); v != "" {
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ERP_REQUESTS_PER_SECOND: %w", err)
+		}
+		cfg.ERP.RequestsPerSecond = rps
+	}
+	if err := setInt("ERP_REQUEST_BURST", &cfg.ERP.RequestBurst); err != nil {
+		return err
+	}
+	if err := setInt("ERP_HTTP_TIMEOUT_SECONDS", &cfg.ERP.HTTP.TimeoutSeconds); err != nil {
+		return err
+	}
+	setString("ERP_PROXY_URL", &cfg.ERP.HTTP.ProxyURL)
+	setString("ERP_CA_FILE", &cfg.ERP.HTTP.CAFile)
+	setString("SCHEDULE_TIMEZONE", &cfg.Schedule.Timezone)
+	setString("DAILY_MORNING_CRON", &cfg.Schedule.DailyMorningCron)
+	setString("DAILY_EVENING_CRON", &cfg.Schedule.DailyEveningCron)
+	if v, ok := os.LookupEnv("CREDENTIAL_CHECK_CRON"); ok {
+		cfg.Schedule.CredentialCheckCron = v
+	}
+	if v := os.Getenv("SCHEDULE_HOLIDAYS"); v != "" {
+		cfg.Schedule.Holidays = strings.Split(v, ",")
+		for i := range cfg.Schedule.Holidays {
+			cfg.Schedule.Holidays[i] = strings.TrimSpace(cfg.Schedule.Holidays[i])
+		}
+	}
+	if err := setInt("MAX_MORNING_DELAY_MINUTES", &cfg.Schedule.MaxMorningDelayMinutes); err != nil {
+		return err
+	}
+	if err := setInt("MAX_EVENING_DELAY_MINUTES", &cfg.Schedule.MaxEveningDelayMinutes); err != nil {
+		return err
+	}
+	setString("CSV_PATH", &cfg.Store.CsvPath)
+	setString("USERS_FILE", &cfg.Store.UsersFile)
+	if v, ok := os.LookupEnv("IDEMPOTENCY_FILE"); ok {
+		cfg.Store.IdempotencyFile = v
+	}
+	setString("DIGEST_CHANNEL", &cfg.Digest.Channel)
+	setString("DIGEST_WEBHOOK_URL", &cfg.Digest.WebhookURL)
+	if v := os.Getenv("RELOAD_WATCH"); v != "" {
+		watch, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid RELOAD_WATCH: %w", err)
+		}
+		cfg.Reload.Watch = watch
+	}
+	if err := setInt("RELOAD_INTERVAL_SECONDS", &cfg.Reload.IntervalSeconds); err != nil {
+		return err
+	}
+	setString("LEADER_BACKEND", &cfg.Leader.Backend)
+	setString("LEADER_LOCK_FILE", &cfg.Leader.LockFile)
+	setString("LEADER_LEASE_NAME", &cfg.Leader.LeaseName)
+	setString("LEADER_NAMESPACE", &cfg.Leader.Namespace)
+	setString("LEADER_IDENTITY", &cfg.Leader.Identity)
+	if v := os.Getenv("PORTAL_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid PORTAL_ENABLED: %w", err)
+		}
+		cfg.Portal.Enabled = enabled
+	}
+	if v := os.Getenv("PORTAL_TRUSTED_PROXIES"); v != "" {
+		cfg.Portal.TrustedProxies = strings.Split(v, ",")
+		for i := range cfg.Portal.TrustedProxies {
+			cfg.Portal.TrustedProxies[i] = strings.TrimSpace(cfg.Portal.TrustedProxies[i])
+		}
+	}
+	return nil
+}
+
+func parseIntList(v string) ([]int, error) {
+	parts := strings.Split(v, ",")
+	ids := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, n)
+	}
+	return ids, nil
+}
+
+// CronParser là parser 6 trường (có giây) dùng chung cho toàn bộ scheduler
+var CronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, fmt.Errorf("server.addr is required"))
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error", "fatal":
+	default:
+		errs = append(errs, fmt.Errorf("log.level %q is not one of debug, info, warn, error, fatal", c.Log.Level))
+	}
+	if c.Log.RecentSize < 1 {
+		errs = append(errs, fmt.Errorf("log.recentSize must be at least 1"))
+	}
+	for i, sink := range c.Log.Sinks {
+		if err := sink.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("log.sinks[%d]: %w", i, err))
+		}
+	}
+	errs = append(errs, c.ERP.validateTenant("erp")...)
+	names := map[string]bool{DefaultInstance: true}
+	for i, inst := range c.ERP.Instances {
+		prefix := fmt.Sprintf("erp.instances[%d]", i)
+		if inst.Name == "" || names[inst.Name] {
+			errs = append(errs, fmt.Errorf("%s.name %q must be set, unique and not %q", prefix, inst.Name, DefaultInstance))
+			continue
+		}
+		names[inst.Name] = true
+		merged, _ := c.ERP.Instance(inst.Name)
+		errs = append(errs, merged.validateTenant(prefix)...)
+	}
+	if c.ERP.MaxConcurrentActions < 1 {
+		errs = append(errs, fmt.Errorf("erp.maxConcurrentActions must be at least 1"))
+	}
+	if c.ERP.HTTP.TimeoutSeconds < 1 || c.ERP.HTTP.DialTimeoutSeconds < 1 {
+		errs = append(errs, fmt.Errorf("erp.http.timeoutSeconds and erp.http.dialTimeoutSeconds must be at least 1"))
+	}
+	if c.ERP.HTTP.ProxyURL != "" {
+		if u, err := url.Parse(c.ERP.HTTP.ProxyURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("erp.http.proxyUrl %q must be an absolute url", redactUserinfo(c.ERP.HTTP.ProxyURL)))
+		}
+	}
+	if c.ERP.RequestsPerSecond > 0 && c.ERP.RequestBurst < 1 {
+		errs = append(errs, fmt.Errorf("erp.requestBurst must be at least 1 when erp.requestsPerSecond is set"))
+	}
+	if _, err := time.LoadLocation(c.Schedule.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("schedule.timezone: %w", err))
+	}
+	if _, err := CronParser.Parse(c.Schedule.DailyMorningCron); err != nil {
+		errs = append(errs, fmt.Errorf("schedule.dailyMorningCron: %w", err))
+	}
+	if _, err := CronParser.Parse(c.Schedule.DailyEveningCron); err != nil {
+		errs = append(errs, fmt.Errorf("schedule.dailyEveningCron: %w", err))
+	}
+	if c.Schedule.CredentialCheckCron != "" {
+		if _, err := CronParser.Parse(c.Schedule.CredentialCheckCron); err != nil {
+			errs = append(errs, fmt.Errorf("schedule.credentialCheckCron: %w", err))
+		}
+	}
+	for i, day := range c.Schedule.Holidays {
+		if _, err := time.Parse(HolidayLayout, day); err != nil {
+			errs = append(errs, fmt.Errorf("schedule.holidays[%d] %q is not a YYYY-MM-DD date", i, day))
+		}
+	}
+	if c.Schedule.MaxMorningDelayMinutes < 1 || c.Schedule.MaxEveningDelayMinutes < 1 {
+		errs = append(errs, fmt.Errorf("schedule max delay minutes must be at least 1"))
+	}
+	if c.Reload.Watch && c.Reload.IntervalSeconds < 1 {
+		errs = append(errs, fmt.Errorf("reload.intervalSeconds must be at least 1 when watch is enabled"))
+	}
+	if c.Store.CsvPath == "" {
+		errs = append(errs, fmt.Errorf("store.csvPath is required"))
+	}
+	switch strings.ToLower(c.Digest.Channel) {
+	case "", "log":
+	case "webhook":
+		if c.Digest.WebhookURL == "" {
+			errs = append(errs, fmt.Errorf("digest.webhookUrl is required for the webhook channel"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("digest.channel %q is not one of log, webhook", c.Digest.Channel))
+	}
+	switch strings.ToLower(c.Leader.Backend) {
+	case "", "none":
+	case "file":
+		if c.Leader.LockFile == "" {
+			errs = append(errs, fmt.Errorf("leader.lockFile is required for the file backend"))
+		}
+	case "kubernetes":
+		if c.Leader.LeaseName == "" {
+			errs = append(errs, fmt.Errorf("leader.leaseName is required for the kubernetes backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("leader.backend %q is not one of none, file, kubernetes", c.Leader.Backend))
+	}
+	if c.Leader.RenewIntervalSeconds < 1 || c.Leader.RenewIntervalSeconds >= c.Leader.LeaseDurationSeconds {
+		errs = append(errs, fmt.Errorf("leader.renewIntervalSeconds must be at least 1 and less than leader.leaseDurationSeconds"))
+	}
+	if c.Portal.Enabled && (c.Portal.SessionMinutes < 1 || c.Portal.MaxFailuresPerUser < 1 || c.Portal.MaxFailuresPerIP < 1 || c.Portal.LoginWindowMinutes < 1) {
+		errs = append(errs, fmt.Errorf("portal.sessionMinutes, maxFailuresPerUser, maxFailuresPerIp and loginWindowMinutes must be at least 1 when the portal is enabled"))
+	}
+	if _, err := c.Portal.ParseTrustedProxies(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// validateTenant kiểm tra các field có thể khác nhau giữa các instance, prefix là đường dẫn dùng trong thông báo lỗi
+func (c ERPConfig) validateTenant(prefix string) []error {
+	var errs []error
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("%s.baseUrl %q must be an absolute url", prefix, c.BaseURL))
+	}
+	if len(c.CompanyIDs) == 0 {
+		errs = append(errs, fmt.Errorf("%s.companyIds must not be empty", prefix))
+	}
+	switch c.LoginMethod {
+	case "", LoginMethodForm:
+	case LoginMethodJSONRPC:
+		if c.Database == "" {
+			errs = append(errs, fmt.Errorf("%s.database is required for the jsonrpc login method", prefix))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s.loginMethod %q is not one of form, jsonrpc", prefix, c.LoginMethod))
+	}
+	return errs
+}
+
+// Instance trả về cấu hình ERP của instance name đã gộp với erp.*; "" và DefaultInstance là chính erp.*
+func (c ERPConfig) Instance(name string) (ERPConfig, bool) {
+	if name == "" || name == DefaultInstance {
+		return c, true
+	}
+	for _, inst := range c.Instances {
+		if inst.Name != name {
+			continue
+		}
+		merged := c
+		setString := func(dst *string, v string) {
+			if v != "" {
+				*dst = v
+			}
+		}
+		setString(&merged.BaseURL, inst.BaseURL)
+		setString(&merged.LoginMethod, inst.LoginMethod)
+		setString(&merged.Database, inst.Database)
+		setString(&merged.Timezone, inst.Timezone)
+		setString(&merged.Lang, inst.Lang)
+		setString(&merged.LocationID, inst.LocationID)
+		if len(inst.CompanyIDs) > 0 {
+			merged.CompanyIDs = inst.CompanyIDs
+		}
+		if inst.Latitude != 0 || inst.Longitude != 0 {
+			merged.Latitude = inst.Latitude
+			merged.Longitude = inst.Longitude
+		}
+		return merged, true
+	}
+	return ERPConfig{}, false
+}
+
+// InstanceNames trả về DefaultInstance và tên các instance theo thứ tự khai báo
+func (c ERPConfig) InstanceNames() []string {
+	names := []string{DefaultInstance}
+	for _, inst := range c.Instances {
+		names = append(names, inst.Name)
+	}
+	return names
+}
+
+func (s LogSinkConfig) validate() error {
+	switch s.Format {
+	case "", "json", "text":
+	default:
+		return fmt.Errorf("format %q is not one of json, text", s.Format)
+	}
+	switch strings.ToLower(s.Level) {
+	case "", "debug", "info", "warn", "error", "fatal":
+	default:
+		return fmt.Errorf("level %q is not one of debug, info, warn, error, fatal", s.Level)
+	}
+	switch s.Type {
+	case "console":
+	case "file":
+		if s.Path == "" {
+			return fmt.Errorf("path is required for file sinks")
+		}
+	default:
+		return fmt.Errorf("type %q is not one of console, file", s.Type)
+	}
+	return nil
+}
+
+// Redacted trả về bản sao an toàn để hiển thị qua API
+func (c Config) Redacted() Config {
+	if c.Digest.WebhookURL != "" {
+		c.Digest.WebhookURL = redacted
+	}
+	c.ERP.HTTP.ProxyURL = redactUserinfo(c.ERP.HTTP.ProxyURL)
+	return c
+}
+
+// redactUserinfo ẩn user:pass@ trong url, ví dụ proxy có xác thực. Url không tách được userinfo mà có @ bị ẩn toàn bộ.
+func redactUserinfo(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		if strings.Contains(raw, "@") {
+			return redacted
+		}
+		return raw
+	}
+	u.User = nil
+	return strings.Replace(u.String(), "//", "//"+redacted+"@", 1)
+}
+
+// Origin là scheme + host của ERP, dùng cho header Origin
+func (c ERPConfig) Origin() string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return c.BaseURL
+	}
+	return u.Scheme + "://" + u.Host
+}
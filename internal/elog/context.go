@@ -0,0 +1,102 @@
+package elog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+)
+
+// Logger is a child logger that adds its fields to every entry.
+type Logger struct {
+	fields Fields
+}
+
+type ctxKey struct{}
+
+var root = &Logger{fields: Fields{}}
+
+// With returns a child logger carrying f on every entry.
+func With(f Fields) *Logger {
+	return root.With(f)
+}
+
+// With returns a child logger with f merged over the parent's fields.
+func (l *Logger) With(f Fields) *Logger {
+	return &Logger{fields: merge(l.fields, f)}
+}
+
+// Fields returns a copy of the fields carried by l.
+func (l *Logger) Fields() Fields {
+	return merge(l.fields, nil)
+}
+
+func merge(base, f Fields) Fields {
+	out := make(Fields, len(base)+len(f))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range f {
+		out[k] = v
+	}
+	return out
+}
+
+// NewContext returns a copy of ctx that carries l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or the root logger when there is none.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return root
+}
+
+// NewID returns a short random hex id for correlating the entries of one run.
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (l *Logger) Debug(msg string, f Fields) {
+	fields := merge(l.fields, f)
+	if !shouldLogFields(LevelDebug, fields) {
+		return
+	}
+	write(baseEntry(LevelDebug, msg, fields))
+}
+
+func (l *Logger) Info(msg string, f Fields) {
+	fields := merge(l.fields, f)
+	if !shouldLogFields(LevelInfo, fields) {
+		return
+	}
+	write(baseEntry(LevelInfo, msg, fields))
+}
+
+func (l *Logger) Warn(msg string, f Fields) {
+	fields := merge(l.fields, f)
+	if !shouldLogFields(LevelWarn, fields) {
+		return
+	}
+	write(baseEntry(LevelWarn, msg, fields))
+}
+
+func (l *Logger) Error(msg string, f Fields) {
+	fields := merge(l.fields, f)
+	if !shouldLogFields(LevelError, fields) {
+		return
+	}
+	write(baseEntry(LevelError, msg, fields))
+}
+
+func (l *Logger) Fatal(msg string, f Fields) {
+	write(baseEntry(LevelFatal, msg, merge(l.fields, f)))
+	os.Exit(1)
+}
@@ -1,9 +1,8 @@
 package elog
 
 import (
-	"encoding/json"
-	"fmt"
 	"os"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -26,110 +25,140 @@ var level atomic.Int32
 type Fields map[string]interface{}
 
 // Init initializes the logger with a level string and service name.
-func Init(levelStr string, svc string) error {
+// Without WithSink options entries go to a JSON console sink, as before.
+func Init(levelStr string, svc string, opts ...Option) error {
 	service = svc
-	switch levelStr {
-	case "debug", "DEBUG":
-		level.Store(int32(LevelDebug))
-	case "info", "INFO":
-		level.Store(int32(LevelInfo))
-	case "warn", "WARN":
-		level.Store(int32(LevelWarn))
-	case "error", "ERROR":
-		level.Store(int32(LevelError))
-	case "fatal", "FATAL":
-		level.Store(int32(LevelFatal))
-	default:
-		// default to info
-		level.Store(int32(LevelInfo))
+	SetLevel(levelStr)
+	if len(opts) > 0 {
+		configured := make([]leveledSink, 0, len(opts))
+		for _, opt := range opts {
+			opt(&configured)
+		}
+		setSinks(configured)
 	}
 	return nil
 }
 
-func shouldLog(l Level) bool {
-	return Level(level.Load()) <= l
+// ParseLevel converts a level string, defaulting to info when unknown.
+func ParseLevel(levelStr string) Level {
+	l, ok := LookupLevel(levelStr)
+	if !ok {
+		// default to info
+		return LevelInfo
+	}
+	return l
 }
 
-func write(entry map[string]interface{}, toStderr bool) {
-	b, err := json.Marshal(entry)
-	if err != nil {
-		// fallback to fmt if marshal fails
-		if toStderr {
-			fmt.Fprintln(os.Stderr, "log marshal error:", err)
-		} else {
-			fmt.Println("log marshal error:", err)
-		}
-		return
+// LookupLevel converts a level string in any case, reporting whether it is known.
+func LookupLevel(levelStr string) (Level, bool) {
+	switch strings.ToLower(levelStr) {
+	case "debug":
+		return LevelDebug, true
+	case "info":
+		return LevelInfo, true
+	case "warn":
+		return LevelWarn, true
+	case "error":
+		return LevelError, true
+	case "fatal":
+		return LevelFatal, true
+	default:
+		return LevelInfo, false
 	}
-	if toStderr {
-		fmt.Fprintln(os.Stderr, string(b))
-	} else {
-		fmt.Fprintln(os.Stdout, string(b))
+}
+
+// SetLevel changes the minimum level at runtime.
+func SetLevel(levelStr string) {
+	level.Store(int32(ParseLevel(levelStr)))
+}
+
+// GetLevel returns the current minimum level.
+func GetLevel() Level {
+	return Level(level.Load())
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "fatal"
 	}
 }
 
-func baseEntry(levelStr, msg string, fields Fields) map[string]interface{} {
-	entry := map[string]interface{}{
-		"ts":      time.Now().Format(time.RFC3339),
-		"level":   levelStr,
-		"service": service,
-		"msg":     msg,
+func shouldLog(l Level) bool {
+	return Level(level.Load()) <= l
+}
+
+func baseEntry(l Level, msg string, fields Fields) Entry {
+	entry := Entry{
+		Time:    time.Now(),
+		Level:   l,
+		Service: service,
+		Msg:     msg,
+		Fields:  Fields{},
 	}
-	for k, v := range fields {
+	for k, v := range redactFields(fields) {
 		// avoid overwriting base keys
 		if k == "ts" || k == "level" || k == "service" || k == "msg" {
 			continue
 		}
-		entry[k] = v
+		entry.Fields[k] = v
 	}
 	return entry
 }
 
 func Debug(msg string, f Fields) {
-	if !shouldLog(LevelDebug) {
+	if !shouldLogFields(LevelDebug, f) {
 		return
 	}
 	if f == nil {
 		f = Fields{}
 	}
-	write(baseEntry("debug", msg, f), false)
+	write(baseEntry(LevelDebug, msg, f))
 }
 
 func Info(msg string, f Fields) {
-	if !shouldLog(LevelInfo) {
+	if !shouldLogFields(LevelInfo, f) {
 		return
 	}
 	if f == nil {
 		f = Fields{}
 	}
-	write(baseEntry("info", msg, f), false)
+	write(baseEntry(LevelInfo, msg, f))
 }
 
 func Warn(msg string, f Fields) {
-	if !shouldLog(LevelWarn) {
+	if !shouldLogFields(LevelWarn, f) {
 		return
 	}
 	if f == nil {
 		f = Fields{}
 	}
-	write(baseEntry("warn", msg, f), false)
+	write(baseEntry(LevelWarn, msg, f))
 }
 
 func Error(msg string, f Fields) {
-	if !shouldLog(LevelError) {
+	if !shouldLogFields(LevelError, f) {
 		return
 	}
 	if f == nil {
 		f = Fields{}
 	}
-	write(baseEntry("error", msg, f), true)
+	write(baseEntry(LevelError, msg, f))
 }
 
 func Fatal(msg string, f Fields) {
 	if f == nil {
 		f = Fields{}
 	}
-	write(baseEntry("fatal", msg, f), true)
+	write(baseEntry(LevelFatal, msg, f))
 	os.Exit(1)
 }
 
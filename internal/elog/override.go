@@ -0,0 +1,118 @@
+package elog
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Override fields: per-user entries carry "user", per-package loggers carry "pkg".
+const (
+	OverrideUser    = "user"
+	OverridePackage = "pkg"
+)
+
+// Override lowers the level for entries whose Field equals Value, e.g. debug for one user.
+// It never silences entries that already pass the global level.
+type Override struct {
+	Field   string    `json:"field"`
+	Value   string    `json:"value"`
+	Level   string    `json:"level"`
+	Expires time.Time `json:"expires"`
+
+	level Level
+}
+
+type overrideKey struct {
+	field, value string
+}
+
+var (
+	overrideMu sync.Mutex
+	overrides  atomic.Pointer[map[overrideKey]Override]
+)
+
+// SetOverride sets the level used for entries whose field equals value. A zero expires never expires.
+func SetOverride(field, value string, l Level, expires time.Time) {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	next := copyOverrides()
+	next[overrideKey{field, value}] = Override{Field: field, Value: value, Level: l.String(), Expires: expires, level: l}
+	overrides.Store(&next)
+}
+
+// RemoveOverride deletes an override, reporting whether it existed.
+func RemoveOverride(field, value string) bool {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	next := copyOverrides()
+	if _, ok := next[overrideKey{field, value}]; !ok {
+		return false
+	}
+	delete(next, overrideKey{field, value})
+	overrides.Store(&next)
+	return true
+}
+
+// Overrides lists the active overrides sorted by field then value.
+func Overrides() []Override {
+	now := time.Now()
+	out := make([]Override, 0)
+	if current := overrides.Load(); current != nil {
+		for _, o := range *current {
+			if o.expired(now) {
+				continue
+			}
+			out = append(out, o)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Field != out[j].Field {
+			return out[i].Field < out[j].Field
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+func copyOverrides() map[overrideKey]Override {
+	next := make(map[overrideKey]Override)
+	if current := overrides.Load(); current != nil {
+		now := time.Now()
+		for k, o := range *current {
+			if !o.expired(now) {
+				next[k] = o
+			}
+		}
+	}
+	return next
+}
+
+func (o Override) expired(now time.Time) bool {
+	return !o.Expires.IsZero() && now.After(o.Expires)
+}
+
+// shouldLogFields applies the global level, then any override matching the entry's fields.
+// When several overrides match, the most verbose one wins.
+func shouldLogFields(l Level, f Fields) bool {
+	if shouldLog(l) {
+		return true
+	}
+	current := overrides.Load()
+	if current == nil || len(*current) == 0 {
+		return false
+	}
+	now := time.Now()
+	for _, field := range []string{OverrideUser, OverridePackage} {
+		value, ok := f[field].(string)
+		if !ok {
+			continue
+		}
+		o, ok := (*current)[overrideKey{field, value}]
+		if ok && !o.expired(now) && o.level <= l {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package elog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserOverride(t *testing.T) {
+	var buf bytes.Buffer
+	_ = Init("info", "test", WithSink(&ConsoleSink{Format: FormatText, Out: &buf, Err: &buf}, LevelDebug))
+	defer Init("info", "", WithSink(NewConsoleSink(FormatJSON), LevelDebug))
+
+	SetOverride(OverrideUser, "alice", LevelDebug, time.Time{})
+	defer RemoveOverride(OverrideUser, "alice")
+	SetOverride(OverrideUser, "bob", LevelDebug, time.Now().Add(-time.Minute))
+
+	With(F("user", "alice")).Debug("alice debug", nil)
+	Debug("bob debug", F("user", "bob"))
+	Debug("carol debug", F("user", "carol"))
+
+	out := buf.String()
+	if !strings.Contains(out, "alice debug") {
+		t.Errorf("override did not enable debug for alice: %q", out)
+	}
+	if strings.Contains(out, "bob debug") || strings.Contains(out, "carol debug") {
+		t.Errorf("debug leaked for users without an active override: %q", out)
+	}
+	if got := Overrides(); len(got) != 1 || got[0].Value != "alice" {
+		t.Errorf("expired override still listed: %+v", got)
+	}
+}
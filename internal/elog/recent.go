@@ -0,0 +1,62 @@
+package elog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultRecentSize is how many entries are kept in memory for GET /admin/logs.
+const DefaultRecentSize = 500
+
+var recent atomic.Pointer[RingSink]
+
+var (
+	subMu       sync.Mutex
+	subscribers = make(map[chan Entry]struct{})
+)
+
+func init() {
+	recent.Store(NewRingSink(DefaultRecentSize))
+}
+
+// SetRecentSize resizes the in-memory buffer of recent entries, dropping what it held.
+func SetRecentSize(size int) {
+	recent.Store(NewRingSink(size))
+}
+
+// Recent returns the buffered recent entries, oldest first.
+func Recent() []Entry {
+	return recent.Load().Entries()
+}
+
+// Subscribe returns a channel receiving every new entry and a function to stop the subscription.
+// Entries are dropped for subscribers whose buffer is full, so a slow reader never blocks logging.
+func Subscribe(buffer int) (<-chan Entry, func()) {
+	ch := make(chan Entry, buffer)
+	subMu.Lock()
+	subscribers[ch] = struct{}{}
+	subMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			subMu.Lock()
+			delete(subscribers, ch)
+			subMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func publish(e Entry) {
+	_ = recent.Load().Write(e)
+
+	subMu.Lock()
+	defer subMu.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package elog
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces the value of any denied field.
+const RedactedValue = "[REDACTED]"
+
+// Redactor lets a type provide a safe representation of itself before it is logged.
+type Redactor interface {
+	Redact() interface{}
+}
+
+var defaultDenyList = []string{"password", "session_id", "sessionid", "csrf_token", "cookie", "authorization", "secret"}
+
+var (
+	denyMu   sync.RWMutex
+	denyList = makeDenySet(defaultDenyList)
+)
+
+func makeDenySet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = struct{}{}
+	}
+	return set
+}
+
+// AddDenyFields adds field names (case-insensitive) whose values are always redacted.
+func AddDenyFields(keys ...string) {
+	denyMu.Lock()
+	defer denyMu.Unlock()
+	for _, k := range keys {
+		denyList[strings.ToLower(k)] = struct{}{}
+	}
+}
+
+func denied(key string) bool {
+	denyMu.RLock()
+	defer denyMu.RUnlock()
+	_, ok := denyList[strings.ToLower(key)]
+	return ok
+}
+
+// redactFields returns a copy of f that is safe to hand to any sink: denied keys are masked,
+// Redactor values are replaced by their safe form, errors become their message and
+// structs/maps/slices are walked so nested denied keys are masked too.
+func redactFields(f Fields) Fields {
+	out := make(Fields, len(f))
+	for k, v := range f {
+		out[k] = redactValue(k, v)
+	}
+	return out
+}
+
+func redactValue(key string, v interface{}) interface{} {
+	if denied(key) {
+		return RedactedValue
+	}
+	if r, ok := v.(Redactor); ok {
+		v = r.Redact()
+	}
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case error:
+		return val.Error()
+	case string, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return val
+	case Fields:
+		return redactFields(val)
+	case map[string]interface{}:
+		return map[string]interface{}(redactFields(val))
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = redactValue("", item)
+		}
+		return out
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		// round-trip through JSON so the deny list also applies to nested json tags
+		b, err := json.Marshal(v)
+		if err != nil {
+			return v
+		}
+		var generic interface{}
+		if err := json.Unmarshal(b, &generic); err != nil {
+			return v
+		}
+		return redactValue("", generic)
+	}
+	return v
+}
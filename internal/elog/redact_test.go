@@ -0,0 +1,55 @@
+package elog
+
+import (
+	"errors"
+	"testing"
+)
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type session struct {
+	ID string
+}
+
+func (s session) Redact() interface{} {
+	return map[string]interface{}{"id": RedactedValue}
+}
+
+func TestRedactFields(t *testing.T) {
+	out := redactFields(Fields{
+		"Password":   "secret",
+		"session_id": "abc",
+		"user":       credentials{Username: "u", Password: "p"},
+		"session":    session{ID: "abc"},
+		"nested":     Fields{"csrf_token": "t", "ok": 1},
+		"err":        errors.New("boom"),
+	})
+
+	if out["Password"] != RedactedValue || out["session_id"] != RedactedValue {
+		t.Errorf("denied top-level keys not redacted: %v", out)
+	}
+	user := out["user"].(map[string]interface{})
+	if user["password"] != RedactedValue || user["username"] != "u" {
+		t.Errorf("nested struct not redacted: %v", user)
+	}
+	if out["session"].(map[string]interface{})["id"] != RedactedValue {
+		t.Errorf("Redactor not applied: %v", out["session"])
+	}
+	nested := out["nested"].(Fields)
+	if nested["csrf_token"] != RedactedValue || nested["ok"] != 1 {
+		t.Errorf("nested fields not redacted: %v", nested)
+	}
+	if out["err"] != "boom" {
+		t.Errorf("error not converted to message: %v", out["err"])
+	}
+}
+
+func TestAddDenyFields(t *testing.T) {
+	AddDenyFields("Api_Key")
+	if out := redactFields(Fields{"api_key": "k"}); out["api_key"] != RedactedValue {
+		t.Errorf("custom deny field not redacted: %v", out)
+	}
+}
@@ -0,0 +1,261 @@
+package elog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is one log line as handed to sinks, after redaction.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Service string
+	Msg     string
+	Fields  Fields
+}
+
+// Map returns the flat JSON shape used by the JSON sinks.
+func (e Entry) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(e.Fields)+4)
+	for k, v := range e.Fields {
+		m[k] = v
+	}
+	m["ts"] = e.Time.Format(time.RFC3339)
+	m["level"] = e.Level.String()
+	m["service"] = e.Service
+	m["msg"] = e.Msg
+	return m
+}
+
+// Sink receives every entry that passes the global level and the sink's own level.
+type Sink interface {
+	Write(e Entry) error
+}
+
+type leveledSink struct {
+	sink  Sink
+	level Level
+}
+
+// Option configures Init.
+type Option func(*[]leveledSink)
+
+// WithSink adds a sink that only receives entries at or above level.
+// Entries are first filtered by the global level, so a sink level below it has no effect.
+func WithSink(s Sink, level Level) Option {
+	return func(sinks *[]leveledSink) {
+		*sinks = append(*sinks, leveledSink{sink: s, level: level})
+	}
+}
+
+var sinks atomic.Pointer[[]leveledSink]
+
+func init() {
+	setSinks([]leveledSink{{sink: NewConsoleSink(FormatJSON), level: LevelDebug}})
+}
+
+func setSinks(s []leveledSink) {
+	sinks.Store(&s)
+}
+
+func write(e Entry) {
+	publish(e)
+	for _, s := range *sinks.Load() {
+		if e.Level < s.level {
+			continue
+		}
+		if err := s.sink.Write(e); err != nil {
+			fmt.Fprintln(os.Stderr, "log sink error:", err)
+		}
+	}
+}
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+func formatEntry(format string, e Entry) ([]byte, error) {
+	if format == FormatText {
+		return []byte(formatText(e)), nil
+	}
+	return json.Marshal(e.Map())
+}
+
+// formatText renders "ts LEVEL msg key=value ..." with keys sorted for stable output.
+func formatText(e Entry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %-5s %s", e.Time.Format(time.RFC3339), strings.ToUpper(e.Level.String()), e.Msg)
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := e.Fields[k]
+		switch v.(type) {
+		case string, bool, int, int32, int64, uint, uint32, uint64, float32, float64, nil:
+			fmt.Fprintf(&sb, " %s=%v", k, v)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				fmt.Fprintf(&sb, " %s=%v", k, v)
+				continue
+			}
+			fmt.Fprintf(&sb, " %s=%s", k, b)
+		}
+	}
+	return sb.String()
+}
+
+// ConsoleSink writes to stdout, and errors and above to stderr.
+type ConsoleSink struct {
+	Format string
+	Out    io.Writer
+	Err    io.Writer
+	mu     sync.Mutex
+}
+
+func NewConsoleSink(format string) *ConsoleSink {
+	return &ConsoleSink{Format: format, Out: os.Stdout, Err: os.Stderr}
+}
+
+func (s *ConsoleSink) Write(e Entry) error {
+	b, err := formatEntry(s.Format, e)
+	if err != nil {
+		return fmt.Errorf("log marshal error: %w", err)
+	}
+	out := s.Out
+	if e.Level >= LevelError {
+		out = s.Err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintln(out, string(b))
+	return err
+}
+
+// FileSink appends to a file and rotates it to path.1 ... path.N once it exceeds MaxSize bytes.
+type FileSink struct {
+	Path       string
+	Format     string
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(path, format string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{Path: path, Format: format, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", s.Path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", s.Path, err)
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(e Entry) error {
+	b, err := formatEntry(s.Format, e)
+	if err != nil {
+		return fmt.Errorf("log marshal error: %w", err)
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxSize > 0 && s.size+int64(len(b)) > s.MaxSize && s.size > 0 {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file %s: %w", s.Path, err)
+	}
+	if s.MaxBackups < 1 {
+		if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+	_ = os.Remove(fmt.Sprintf("%s.%d", s.Path, s.MaxBackups))
+	for i := s.MaxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.Path, i), fmt.Sprintf("%s.%d", s.Path, i+1))
+	}
+	if err := os.Rename(s.Path, s.Path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log file %s: %w", s.Path, err)
+	}
+	return s.open()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// RingSink keeps the last Size entries in memory.
+type RingSink struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+func NewRingSink(size int) *RingSink {
+	if size < 1 {
+		size = 1
+	}
+	return &RingSink{entries: make([]Entry, size)}
+}
+
+func (s *RingSink) Write(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[s.next] = e
+	s.next = (s.next + 1) % len(s.entries)
+	if s.next == 0 {
+		s.full = true
+	}
+	return nil
+}
+
+// Entries returns the buffered entries, oldest first.
+func (s *RingSink) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.full {
+		return append([]Entry(nil), s.entries[:s.next]...)
+	}
+	out := make([]Entry, 0, len(s.entries))
+	out = append(out, s.entries[s.next:]...)
+	return append(out, s.entries[:s.next]...)
+}
@@ -0,0 +1,78 @@
+package elog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	sink, err := NewFileSink(path, FormatJSON, 200, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := sink.Write(Entry{Time: time.Now(), Level: LevelInfo, Msg: strings.Repeat("x", 60)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("expected %s: %v", p, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s exceeds max size: %d", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, stat .3: %v", err)
+	}
+}
+
+func TestRingSinkKeepsLastEntries(t *testing.T) {
+	ring := NewRingSink(3)
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		_ = ring.Write(Entry{Msg: msg})
+	}
+	entries := ring.Entries()
+	if len(entries) != 3 || entries[0].Msg != "b" || entries[2].Msg != "d" {
+		t.Errorf("unexpected ring entries %+v", entries)
+	}
+}
+
+func TestSinkLevels(t *testing.T) {
+	var all, errorsOnly bytes.Buffer
+	_ = Init("debug", "test",
+		WithSink(&ConsoleSink{Format: FormatText, Out: &all, Err: &all}, LevelDebug),
+		WithSink(&ConsoleSink{Format: FormatJSON, Out: &errorsOnly, Err: &errorsOnly}, LevelError),
+	)
+	defer Init("info", "", WithSink(NewConsoleSink(FormatJSON), LevelDebug))
+
+	Info("hello", F("user", "u"))
+	Error("boom", nil)
+
+	if !strings.Contains(all.String(), "INFO  hello user=u") || !strings.Contains(all.String(), "boom") {
+		t.Errorf("text sink missing entries: %q", all.String())
+	}
+	if strings.Contains(errorsOnly.String(), "hello") || !strings.Contains(errorsOnly.String(), `"msg":"boom"`) {
+		t.Errorf("error sink level not applied: %q", errorsOnly.String())
+	}
+}
+
+func TestLookupLevel(t *testing.T) {
+	for _, s := range []string{"debug", "DEBUG", "Debug"} {
+		if l, ok := LookupLevel(s); !ok || l != LevelDebug {
+			t.Errorf("LookupLevel(%q) = %v, %v", s, l, ok)
+		}
+	}
+	if _, ok := LookupLevel("verbose"); ok {
+		t.Error("unknown level should not be found")
+	}
+}
@@ -0,0 +1,52 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileLock elects the process holding an exclusive lock on Path. It only protects
+// replicas on the same host (or a shared filesystem with working locks); the lock is
+// dropped by the OS when the process exits.
+type FileLock struct {
+	Path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{Path: path}
+}
+
+func (l *FileLock) Acquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return true, nil
+	}
+	f, err := os.OpenFile(l.Path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to open lock file %s: %w", l.Path, err)
+	}
+	ok, err := lockFile(f)
+	if err != nil || !ok {
+		_ = f.Close()
+		return false, err
+	}
+	l.file = f
+	return true, nil
+}
+
+func (l *FileLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := unlockFile(l.file)
+	_ = l.file.Close()
+	l.file = nil
+	return err
+}
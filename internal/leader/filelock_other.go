@@ -0,0 +1,16 @@
+//go:build !unix
+
+package leader
+
+import (
+	"errors"
+	"os"
+)
+
+func lockFile(f *os.File) (bool, error) {
+	return false, errors.New("file lock leader election is not supported on this platform")
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
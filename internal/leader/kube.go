@@ -0,0 +1,167 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"resty.dev/v3"
+)
+
+// Paths of the in-cluster service account mounted into every pod.
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	kubeTokenFile     = serviceAccountDir + "/token"
+	kubeCAFile        = serviceAccountDir + "/ca.crt"
+	kubeNamespaceFile = serviceAccountDir + "/namespace"
+)
+
+// microTimeLayout is the format of metav1.MicroTime fields such as renewTime.
+const microTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// KubeLeaseBackend reads and writes a coordination.k8s.io/v1 Lease through the API server,
+// authenticated with the pod's service account. The pod needs get, create and update on leases.
+type KubeLeaseBackend struct {
+	client    *resty.Client
+	leaseURL  string
+	namespace string
+	name      string
+}
+
+// NewKubeLeaseBackend uses the in-cluster API server. An empty namespace means the pod's own namespace.
+func NewKubeLeaseBackend(namespace, name string) (*KubeLeaseBackend, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("kubernetes lease backend requires running in a cluster (KUBERNETES_SERVICE_HOST is not set)")
+	}
+	if namespace == "" {
+		raw, err := os.ReadFile(kubeNamespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(raw))
+	}
+	if name == "" {
+		return nil, fmt.Errorf("kubernetes lease backend requires a lease name")
+	}
+	client := resty.New().
+		SetBaseURL("https://"+host+":"+port).
+		SetRootCertificates(kubeCAFile).
+		SetTimeout(10*time.Second).
+		SetHeader("Accept", "application/json")
+	return &KubeLeaseBackend{
+		client:    client,
+		leaseURL:  fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", namespace),
+		namespace: namespace,
+		name:      name,
+	}, nil
+}
+
+type kubeLease struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   kubeLeaseMetadata `json:"metadata"`
+	Spec       kubeLeaseSpec     `json:"spec"`
+}
+
+type kubeLeaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type kubeLeaseSpec struct {
+	HolderIdentity       *string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int     `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string  `json:"acquireTime,omitempty"`
+	RenewTime            string  `json:"renewTime,omitempty"`
+	LeaseTransitions     int     `json:"leaseTransitions"`
+}
+
+func (b *KubeLeaseBackend) Get(ctx context.Context) (Lease, error) {
+	var out kubeLease
+	resp, err := b.request(ctx).SetResult(&out).Get(b.leaseURL + "/" + b.name)
+	if err != nil {
+		return Lease{}, err
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return Lease{}, ErrLeaseNotFound
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return Lease{}, fmt.Errorf("get lease: http %d: %s", resp.StatusCode(), resp.String())
+	}
+	return fromKubeLease(out), nil
+}
+
+func (b *KubeLeaseBackend) Create(ctx context.Context, l Lease) error {
+	resp, err := b.request(ctx).SetBody(b.toKubeLease(l)).Post(b.leaseURL)
+	if err != nil {
+		return err
+	}
+	return leaseWriteError("create", resp)
+}
+
+func (b *KubeLeaseBackend) Update(ctx context.Context, l Lease) error {
+	resp, err := b.request(ctx).SetBody(b.toKubeLease(l)).Put(b.leaseURL + "/" + b.name)
+	if err != nil {
+		return err
+	}
+	return leaseWriteError("update", resp)
+}
+
+// request reads the token on every call because projected service account tokens are rotated.
+func (b *KubeLeaseBackend) request(ctx context.Context) *resty.Request {
+	req := b.client.R().SetContext(ctx).SetHeader("Content-Type", "application/json")
+	if token, err := os.ReadFile(kubeTokenFile); err == nil {
+		req.SetAuthToken(strings.TrimSpace(string(token)))
+	}
+	return req
+}
+
+func leaseWriteError(op string, resp *resty.Response) error {
+	switch resp.StatusCode() {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return ErrLeaseConflict
+	}
+	return fmt.Errorf("%s lease: http %d: %s", op, resp.StatusCode(), resp.String())
+}
+
+func (b *KubeLeaseBackend) toKubeLease(l Lease) kubeLease {
+	holder := l.HolderIdentity
+	out := kubeLease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   kubeLeaseMetadata{Name: b.name, Namespace: b.namespace, ResourceVersion: l.ResourceVersion},
+		Spec: kubeLeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: l.LeaseDurationSeconds,
+			LeaseTransitions:     l.LeaseTransitions,
+		},
+	}
+	if !l.AcquireTime.IsZero() {
+		out.Spec.AcquireTime = l.AcquireTime.UTC().Format(microTimeLayout)
+	}
+	if !l.RenewTime.IsZero() {
+		out.Spec.RenewTime = l.RenewTime.UTC().Format(microTimeLayout)
+	}
+	return out
+}
+
+func fromKubeLease(k kubeLease) Lease {
+	l := Lease{
+		LeaseDurationSeconds: k.Spec.LeaseDurationSeconds,
+		LeaseTransitions:     k.Spec.LeaseTransitions,
+		ResourceVersion:      k.Metadata.ResourceVersion,
+	}
+	if k.Spec.HolderIdentity != nil {
+		l.HolderIdentity = *k.Spec.HolderIdentity
+	}
+	l.AcquireTime, _ = time.Parse(time.RFC3339Nano, k.Spec.AcquireTime)
+	l.RenewTime, _ = time.Parse(time.RFC3339Nano, k.Spec.RenewTime)
+	return l
+}
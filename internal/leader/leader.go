@@ -0,0 +1,123 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-ngsc-erp/internal/elog"
+)
+
+const (
+	BackendNone       = "none"
+	BackendFile       = "file"
+	BackendKubernetes = "kubernetes"
+)
+
+// Elector decides which replica runs the scheduler.
+type Elector interface {
+	// Acquire takes or renews leadership and reports whether this instance is the leader.
+	Acquire(ctx context.Context) (bool, error)
+	// Release gives up leadership so another replica can take over without waiting for expiry.
+	Release(ctx context.Context) error
+}
+
+var (
+	enabled atomic.Bool
+	leading atomic.Bool
+)
+
+// Enabled reports whether leader election is running. Without it every instance acts as leader.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// IsLeader reports whether this instance currently holds leadership.
+func IsLeader() bool {
+	return !enabled.Load() || leading.Load()
+}
+
+// Identity returns a name for this instance: POD_NAME, then the hostname.
+func Identity() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return fmt.Sprintf("pid-%d", os.Getpid())
+}
+
+// Run calls Acquire every interval until ctx is done. onStart runs when this instance becomes
+// leader and onStop when it loses leadership, including when ctx ends while leading.
+// An Acquire error counts as lost leadership so two replicas never both keep running.
+func Run(ctx context.Context, e Elector, interval time.Duration, onStart, onStop func()) {
+	enabled.Store(true)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ok, err := e.Acquire(ctx)
+		if err != nil {
+			elog.Warn("leader election failed", elog.Fields{"err": err, elog.OverridePackage: "leader"})
+		}
+		switch {
+		case ok && err == nil && !leading.Load():
+			leading.Store(true)
+			elog.Info("became leader", elog.F(elog.OverridePackage, "leader"))
+			onStart()
+		case (!ok || err != nil) && leading.Load():
+			leading.Store(false)
+			elog.Warn("lost leadership", elog.F(elog.OverridePackage, "leader"))
+			onStop()
+		}
+
+		select {
+		case <-ctx.Done():
+			if leading.Swap(false) {
+				onStop()
+			}
+			// Release is a no-op when another replica holds leadership
+			releaseCtx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := e.Release(releaseCtx); err != nil {
+				elog.Warn("failed to release leadership", elog.Fields{"err": err, elog.OverridePackage: "leader"})
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Config selects and tunes the election backend.
+type Config struct {
+	Backend       string
+	LockFile      string
+	LeaseName     string
+	Namespace     string
+	Identity      string
+	LeaseDuration time.Duration
+}
+
+// New builds the Elector for cfg.Backend. BackendNone returns nil: the caller runs the scheduler directly.
+func New(cfg Config) (Elector, error) {
+	identity := cfg.Identity
+	if identity == "" {
+		identity = Identity()
+	}
+	switch strings.ToLower(cfg.Backend) {
+	case "", BackendNone:
+		return nil, nil
+	case BackendFile:
+		return NewFileLock(cfg.LockFile), nil
+	case BackendKubernetes:
+		backend, err := NewKubeLeaseBackend(cfg.Namespace, cfg.LeaseName)
+		if err != nil {
+			return nil, err
+		}
+		return NewLeaseElector(backend, identity, cfg.LeaseDuration), nil
+	}
+	return nil, fmt.Errorf("unknown leader election backend %q", cfg.Backend)
+}
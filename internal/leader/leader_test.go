@@ -0,0 +1,164 @@
+package leader
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeaseBackend keeps the lease in memory with Kubernetes-like optimistic locking.
+type fakeLeaseBackend struct {
+	mu      sync.Mutex
+	lease   *Lease
+	version int
+}
+
+func (b *fakeLeaseBackend) Get(ctx context.Context) (Lease, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lease == nil {
+		return Lease{}, ErrLeaseNotFound
+	}
+	return *b.lease, nil
+}
+
+func (b *fakeLeaseBackend) Create(ctx context.Context, l Lease) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lease != nil {
+		return ErrLeaseConflict
+	}
+	return b.store(l)
+}
+
+func (b *fakeLeaseBackend) Update(ctx context.Context, l Lease) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lease == nil || b.lease.ResourceVersion != l.ResourceVersion {
+		return ErrLeaseConflict
+	}
+	return b.store(l)
+}
+
+func (b *fakeLeaseBackend) store(l Lease) error {
+	b.version++
+	l.ResourceVersion = strconv.Itoa(b.version)
+	b.lease = &l
+	return nil
+}
+
+func TestLeaseElectorFailover(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeLeaseBackend{}
+	now := time.Date(2025, 11, 28, 8, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	a := NewLeaseElector(backend, "pod-a", 15*time.Second)
+	b := NewLeaseElector(backend, "pod-b", 15*time.Second)
+	a.now, b.now = clock, clock
+
+	mustAcquire := func(e *LeaseElector, want bool) {
+		t.Helper()
+		got, err := e.Acquire(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", e.identity, err)
+		}
+		if got != want {
+			t.Fatalf("%s: leader = %v, want %v", e.identity, got, want)
+		}
+	}
+
+	mustAcquire(a, true)
+	mustAcquire(b, false)
+
+	// a keeps renewing within the lease duration
+	now = now.Add(10 * time.Second)
+	mustAcquire(a, true)
+	now = now.Add(10 * time.Second)
+	mustAcquire(b, false)
+
+	// a stops renewing: b takes over once the lease expires and a cannot get it back
+	now = now.Add(16 * time.Second)
+	mustAcquire(b, true)
+	mustAcquire(a, false)
+	if backend.lease.LeaseTransitions != 1 {
+		t.Errorf("lease transitions = %d, want 1", backend.lease.LeaseTransitions)
+	}
+
+	// releasing hands over immediately
+	if err := b.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mustAcquire(a, true)
+}
+
+func TestFileLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "scheduler.lock")
+	a, b := NewFileLock(path), NewFileLock(path)
+
+	if ok, err := a.Acquire(ctx); !ok || err != nil {
+		t.Fatalf("a: %v %v", ok, err)
+	}
+	if ok, err := b.Acquire(ctx); ok || err != nil {
+		t.Fatalf("b should not acquire while a holds the lock: %v %v", ok, err)
+	}
+	if err := a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.Acquire(ctx); !ok || err != nil {
+		t.Fatalf("b after release: %v %v", ok, err)
+	}
+	_ = b.Release(ctx)
+}
+
+// scriptedElector returns the next scripted result on every Acquire.
+type scriptedElector struct {
+	results chan bool
+}
+
+func (e *scriptedElector) Acquire(ctx context.Context) (bool, error) {
+	select {
+	case ok := <-e.results:
+		return ok, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (e *scriptedElector) Release(ctx context.Context) error { return nil }
+
+func TestRunStartsAndStopsScheduler(t *testing.T) {
+	e := &scriptedElector{results: make(chan bool)}
+	events := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, e, time.Millisecond, func() { events <- "start" }, func() { events <- "stop" })
+		close(done)
+	}()
+
+	for _, ok := range []bool{true, true, false, true} {
+		e.results <- ok
+	}
+	cancel()
+	<-done
+
+	want := []string{"start", "stop", "start", "stop"}
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Fatalf("got event %q, want %q", got, w)
+			}
+		default:
+			t.Fatalf("missing event %q", w)
+		}
+	}
+	if IsLeader() {
+		t.Error("should not be leader after Run returns")
+	}
+}
@@ -0,0 +1,132 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const DefaultLeaseDuration = 15 * time.Second
+
+var (
+	ErrLeaseNotFound = errors.New("lease not found")
+	// ErrLeaseConflict means the lease changed since it was read; another replica won the race.
+	ErrLeaseConflict = errors.New("lease was modified concurrently")
+)
+
+// Lease mirrors the fields of a coordination.k8s.io/v1 Lease used for election.
+type Lease struct {
+	HolderIdentity       string
+	LeaseDurationSeconds int
+	AcquireTime          time.Time
+	RenewTime            time.Time
+	LeaseTransitions     int
+	// ResourceVersion is opaque to the elector and passed back on Update for optimistic locking.
+	ResourceVersion string
+}
+
+func (l Lease) expired(now time.Time) bool {
+	return !now.Before(l.RenewTime.Add(time.Duration(l.LeaseDurationSeconds) * time.Second))
+}
+
+// LeaseBackend stores a single lease. Update must fail with ErrLeaseConflict when
+// the lease's ResourceVersion is stale, and Create when the lease already exists.
+type LeaseBackend interface {
+	Get(ctx context.Context) (Lease, error)
+	Create(ctx context.Context, l Lease) error
+	Update(ctx context.Context, l Lease) error
+}
+
+// LeaseElector holds leadership while it keeps renewing the lease within its duration.
+// Another replica takes over once the lease has not been renewed for LeaseDurationSeconds.
+type LeaseElector struct {
+	backend  LeaseBackend
+	identity string
+	duration time.Duration
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+func NewLeaseElector(backend LeaseBackend, identity string, duration time.Duration) *LeaseElector {
+	if duration <= 0 {
+		duration = DefaultLeaseDuration
+	}
+	return &LeaseElector{backend: backend, identity: identity, duration: duration, now: time.Now}
+}
+
+func (e *LeaseElector) Acquire(ctx context.Context) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+
+	lease, err := e.backend.Get(ctx)
+	if errors.Is(err, ErrLeaseNotFound) {
+		err = e.backend.Create(ctx, Lease{
+			HolderIdentity:       e.identity,
+			LeaseDurationSeconds: e.durationSeconds(),
+			AcquireTime:          now,
+			RenewTime:            now,
+		})
+		if errors.Is(err, ErrLeaseConflict) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to create lease: %w", err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get lease: %w", err)
+	}
+
+	if lease.HolderIdentity != e.identity {
+		if lease.HolderIdentity != "" && !lease.expired(now) {
+			return false, nil
+		}
+		lease.HolderIdentity = e.identity
+		lease.AcquireTime = now
+		lease.LeaseTransitions++
+	}
+	lease.RenewTime = now
+	lease.LeaseDurationSeconds = e.durationSeconds()
+	err = e.backend.Update(ctx, lease)
+	if errors.Is(err, ErrLeaseConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update lease: %w", err)
+	}
+	return true, nil
+}
+
+// Release clears the holder if this instance still holds the lease.
+func (e *LeaseElector) Release(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	lease, err := e.backend.Get(ctx)
+	if errors.Is(err, ErrLeaseNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get lease: %w", err)
+	}
+	if lease.HolderIdentity != e.identity {
+		return nil
+	}
+	lease.HolderIdentity = ""
+	err = e.backend.Update(ctx, lease)
+	if err != nil && !errors.Is(err, ErrLeaseConflict) {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	return nil
+}
+
+func (e *LeaseElector) durationSeconds() int {
+	secs := int(e.duration / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
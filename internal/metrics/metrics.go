@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ngsc"
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDryRun  = "dry_run"
+	OutcomeSkipped = "skipped"
+)
+
+var (
+	LoginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "ERP login attempts by user and outcome.",
+	}, []string{"user", "outcome"})
+
+	AttendanceAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "attendance_attempts_total",
+		Help:      "Attendance actions by user, action and outcome.",
+	}, []string{"user", "action", "outcome"})
+
+	ERPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "erp_request_duration_seconds",
+		Help:      "Latency of HTTP requests sent to the ERP.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint", "method"})
+
+	PendingJobs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scheduled_pending_jobs",
+		Help:      "One-time attendance jobs scheduled but not run yet.",
+	})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		LoginAttempts,
+		AttendanceAttempts,
+		ERPRequestDuration,
+		PendingJobs,
+	)
+}
+
+// RegisterGaugeFunc exposes a gauge whose value is read from fn at scrape time.
+func RegisterGaugeFunc(name, help string, fn func() float64) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+// ObserveERPRequest records the time elapsed since start for one ERP call.
+func ObserveERPRequest(endpoint, method string, start time.Time) {
+	ERPRequestDuration.WithLabelValues(endpoint, method).Observe(time.Since(start).Seconds())
+}
+
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
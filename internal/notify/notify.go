@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-ngsc-erp/internal/elog"
+
+	"resty.dev/v3"
+)
+
+const (
+	ChannelLog     = "log"
+	ChannelWebhook = "webhook"
+)
+
+// DefaultWebhookTimeout bounds a webhook call so a hung endpoint cannot block the digest job or action workers.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// Notifier delivers a plain-text message to admins.
+type Notifier interface {
+	Notify(subject, body string) error
+}
+
+// New builds a Notifier for the given channel name. An empty channel falls back to the log channel.
+func New(channel, webhookURL string) (Notifier, error) {
+	switch strings.ToLower(channel) {
+	case "", ChannelLog:
+		return LogNotifier{}, nil
+	case ChannelWebhook:
+		if webhookURL == "" {
+			return nil, fmt.Errorf("webhook channel requires a webhook url")
+		}
+		return &WebhookNotifier{URL: webhookURL, Timeout: DefaultWebhookTimeout}, nil
+	default:
+		return nil, fmt.Errorf("unknown notify channel %q", channel)
+	}
+}
+
+// LogNotifier writes the message through elog.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(subject, body string) error {
+	elog.Info(subject, elog.F("body", body))
+	return nil
+}
+
+// WebhookNotifier posts {"text": "..."} to an incoming webhook (Slack, Mattermost, Google Chat...).
+type WebhookNotifier struct {
+	URL string
+	// Timeout covers the whole request; zero uses DefaultWebhookTimeout.
+	Timeout time.Duration
+}
+
+type webhookPayload struct {
+	Text string `json:"text"`
+}
+
+func (n *WebhookNotifier) Notify(subject, body string) error {
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	restyClient := resty.New().SetTimeout(timeout)
+	defer func(restyClient *resty.Client) {
+		err := restyClient.Close()
+		if err != nil {
+			elog.Error("error closing resty client", elog.F("err", err))
+		}
+	}(restyClient)
+
+	resp, err := restyClient.R().
+		SetBody(webhookPayload{Text: subject + "\n" + body}).
+		SetContentType("application/json").
+		Post(n.URL)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return fmt.Errorf("webhook returned httpCode %d", resp.StatusCode())
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n := &WebhookNotifier{URL: srv.URL, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if err := n.Notify("subject", "body"); err == nil {
+		t.Fatal("a hung webhook should fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("notify took %s, want it bounded by the timeout", elapsed)
+	}
+}
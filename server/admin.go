@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-ngsc-erp/internal/elog"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func getLogLevel(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, LogLevelResponse{Level: elog.GetLevel().String(), Overrides: elog.Overrides()})
+}
+
+func putLogLevel(w http.ResponseWriter, r *http.Request) {
+	level, _, ok := decodeLogLevel(w, r)
+	if !ok {
+		return
+	}
+	elog.SetLevel(level.String())
+	elog.FromContext(r.Context()).Info("log level changed", elog.F("level", level.String()))
+	getLogLevel(w, r)
+}
+
+// putLogLevelOverride đặt level riêng cho một user hoặc package, ví dụ debug cho một tài khoản đang lỗi
+func putLogLevelOverride(field string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		level, ttl, ok := decodeLogLevel(w, r)
+		if !ok {
+			return
+		}
+		value := chi.URLParam(r, "name")
+		var expires time.Time
+		if ttl > 0 {
+			expires = time.Now().Add(ttl)
+		}
+		elog.SetOverride(field, value, level, expires)
+		elog.FromContext(r.Context()).Info("log level override set", elog.Fields{"field": field, "value": value, "level": level.String(), "expires": expires})
+		getLogLevel(w, r)
+	}
+}
+
+func deleteLogLevelOverride(field string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value := chi.URLParam(r, "name")
+		if !elog.RemoveOverride(field, value) {
+			http.Error(w, "override not found", http.StatusNotFound)
+			return
+		}
+		elog.FromContext(r.Context()).Info("log level override removed", elog.Fields{"field": field, "value": value})
+		getLogLevel(w, r)
+	}
+}
+
+func decodeLogLevel(w http.ResponseWriter, r *http.Request) (elog.Level, time.Duration, bool) {
+	var req LogLevelRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		elog.FromContext(r.Context()).Warn("invalid log level payload", elog.F("err", err))
+		http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+		return 0, 0, false
+	}
+	level, ok := elog.LookupLevel(req.Level)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid level %q", req.Level), http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return level, time.Duration(req.TTLSeconds) * time.Second, true
+}
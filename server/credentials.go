@@ -0,0 +1,54 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/app"
+	"net/http"
+
+	"go-ngsc-erp/internal/elog"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// listCredentials trả về kết quả đăng nhập gần nhất của từng user, suppressed=true là user đang bị tạm dừng
+func listCredentials(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, app.ListCredentialStates())
+}
+
+// checkCredentials thử đăng nhập một user ngay, kể cả khi user đang bị tạm dừng
+func checkCredentials(w http.ResponseWriter, r *http.Request) {
+	state, err := app.CheckCredentials(r.Context(), chi.URLParam(r, "name"))
+	switch {
+	case err == nil:
+		render.JSON(w, r, state)
+	case errors.Is(err, app.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, erp.ErrUnknownInstance):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		elog.FromContext(r.Context()).Error("credential check failed", elog.F("err", err))
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
+
+// updateCredentials đổi mật khẩu và secret TOTP của một user, gỡ trạng thái INVALID_CREDENTIALS
+func updateCredentials(w http.ResponseWriter, r *http.Request) {
+	var req UpdateCredentialsRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		elog.FromContext(r.Context()).Warn("invalid credentials payload", elog.F("err", err))
+		http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	err := app.UpdateCredentials(chi.URLParam(r, "name"), req.Password, req.TOTPSecret)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, app.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+	}
+}
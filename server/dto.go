@@ -1,6 +1,33 @@
 package server
 
+import "go-ngsc-erp/internal/elog"
+
 type CronnJobConfig struct {
 	DailyMorningCron string `json:"dailyMorningCron"`
 	DailyEveningCron string `json:"dailyEveningCron"`
 }
+
+type CheckResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type LogLevelRequest struct {
+	Level      string `json:"level"`
+	TTLSeconds int    `json:"ttlSeconds"`
+}
+
+type LogLevelResponse struct {
+	Level     string          `json:"level"`
+	Overrides []elog.Override `json:"overrides"`
+}
+
+type UpdateCredentialsRequest struct {
+	Password   string `json:"password"`
+	TOTPSecret string `json:"totpSecret"`
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/leader"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+const erpCheckTimeout = 5 * time.Second
+
+// healthz chỉ xác nhận process còn sống
+func healthz(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, map[string]string{"status": "ok"})
+}
+
+// readyz kiểm tra các thành phần con, thêm ?erp=true để kiểm tra cả trang đăng nhập của mọi ERP instance
+func readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]CheckResult{
+		"scheduler": toCheckResult(checkScheduler()),
+		"csvWriter": toCheckResult(app.CheckCsvWriter()),
+		"store":     toCheckResult(app.CheckStoreWritable()),
+	}
+	if r.URL.Query().Get("erp") == "true" {
+		for _, name := range erp.Settings().InstanceNames() {
+			key := "erp"
+			if name != config.DefaultInstance {
+				key = "erp:" + name
+			}
+			checks[key] = toCheckResult(login.CheckLoginPage(name, erpCheckTimeout))
+		}
+	}
+
+	resp := ReadinessResponse{Status: "ok", Checks: checks}
+	for _, c := range checks {
+		if !c.OK {
+			resp.Status = "fail"
+			render.Status(r, http.StatusServiceUnavailable)
+			break
+		}
+	}
+	render.JSON(w, r, resp)
+}
+
+// checkScheduler bỏ qua replica không phải leader: replica đó vẫn phục vụ API, scheduler chạy ở leader
+func checkScheduler() error {
+	if !leader.IsLeader() {
+		return nil
+	}
+	if !app.SchedulerStarted() {
+		return fmt.Errorf("cron scheduler is not started")
+	}
+	return nil
+}
+
+func toCheckResult(err error) CheckResult {
+	if err != nil {
+		return CheckResult{OK: false, Error: err.Error()}
+	}
+	return CheckResult{OK: true}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/erp/app"
+)
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func readiness(t *testing.T) (int, ReadinessResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp ReadinessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad readiness payload %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+var csvWriterOnce sync.Once
+
+// startCsvWriter chạy WaitForWritingLog một lần cho cả test binary: CsvWriterChan đóng rồi thì không mở lại được
+func startCsvWriter(t *testing.T) {
+	csvWriterOnce.Do(func() { go app.WaitForWritingLog() })
+	deadline := time.Now().Add(2 * time.Second)
+	for app.CheckCsvWriter() != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := app.CheckCsvWriter(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	oldPath := app.CsvPath
+	app.CsvPath = filepath.Join(t.TempDir(), "attendance.csv")
+	defer func() { app.CsvPath = oldPath }()
+
+	// Chưa có scheduler và file CSV: không sẵn sàng, payload chỉ ra thành phần lỗi
+	code, resp := readiness(t)
+	if code != http.StatusServiceUnavailable || resp.Status != "fail" {
+		t.Errorf("before start: got %d %q, want 503 fail", code, resp.Status)
+	}
+	for _, name := range []string{"scheduler", "store"} {
+		if c, ok := resp.Checks[name]; !ok || c.OK || c.Error == "" {
+			t.Errorf("before start: check %s = %+v, want a failure with an error", name, c)
+		}
+	}
+	if c := resp.Checks["csvWriter"]; !c.OK && c.Error == "" {
+		t.Errorf("csvWriter check failed without an error: %+v", c)
+	}
+
+	startCsvWriter(t)
+	if err := os.WriteFile(app.CsvPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	app.RunJob()
+	defer app.StopJob()
+
+	code, resp = readiness(t)
+	if code != http.StatusOK || resp.Status != "ok" {
+		t.Errorf("after start: got %d %+v, want 200 ok", code, resp)
+	}
+	if _, ok := resp.Checks["erp"]; ok {
+		t.Error("erp is only checked with ?erp=true")
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"errors"
+	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/erp/login"
+	"net/http"
+
+	"go-ngsc-erp/internal/elog"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// listIdentities trả về kết quả đối chiếu userId/argId của từng user, status MISMATCH cần operator sửa lại
+func listIdentities(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, app.ListIdentities())
+}
+
+// discoverIdentity đăng nhập và tra lại uid/employee ID cho một user ngay lập tức
+func discoverIdentity(w http.ResponseWriter, r *http.Request) {
+	status, err := app.DiscoverIdentity(r.Context(), chi.URLParam(r, "name"))
+	switch {
+	case err == nil:
+		render.JSON(w, r, status)
+	case errors.Is(err, app.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, login.ErrInvalidCredentials), errors.Is(err, login.ErrAccountLocked),
+		errors.Is(err, login.ErrTOTPRequired), errors.Is(err, login.ErrTOTPInvalid):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		elog.FromContext(r.Context()).Error("identity discovery failed", elog.F("err", err))
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
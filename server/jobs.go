@@ -0,0 +1,77 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"go-ngsc-erp/erp/app"
+	"net/http"
+	"strconv"
+
+	"go-ngsc-erp/internal/elog"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/robfig/cron/v3"
+)
+
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := app.ListJobs()
+	if err != nil {
+		writeJobError(w, r, err)
+		return
+	}
+	render.JSON(w, r, jobs)
+}
+
+func cancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := jobIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := app.CancelJob(id); err != nil {
+		writeJobError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func runJobNow(w http.ResponseWriter, r *http.Request) {
+	id, err := jobIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	run := app.RunJobNow
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dryRun {
+		run = app.DryRunJob
+	}
+	if err := run(id, force); err != nil {
+		writeJobError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func jobIDParam(r *http.Request) (cron.EntryID, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid job id: %w", err)
+	}
+	return cron.EntryID(id), nil
+}
+
+func writeJobError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, app.ErrJobNotFound), errors.Is(err, app.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, app.ErrJobNotCancelable), errors.Is(err, app.ErrJobAlreadyRunning), errors.Is(err, app.ErrJobNotDryRunnable):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, app.ErrSchedulerNotStarted), errors.Is(err, app.ErrActionQueueFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		elog.FromContext(r.Context()).Error("job request failed", elog.F("err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/erp/app"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robfig/cron/v3"
+)
+
+func jobsRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/jobs", listJobs)
+	r.Delete("/jobs/{id}", cancelJob)
+	r.Post("/jobs/{id}/run-now", runJobNow)
+	return r
+}
+
+func jobsRequest(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func listedJobs(t *testing.T, h http.Handler) []app.JobInfo {
+	t.Helper()
+	w := jobsRequest(h, http.MethodGet, "/jobs")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /jobs: got %d %q", w.Code, w.Body.String())
+	}
+	var jobs []app.JobInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+func findJob(t *testing.T, h http.Handler, id cron.EntryID) app.JobInfo {
+	t.Helper()
+	for _, j := range listedJobs(t, h) {
+		if j.ID == id {
+			return j
+		}
+	}
+	return app.JobInfo{}
+}
+
+func TestJobsAPI(t *testing.T) {
+	h := jobsRouter()
+	if w := jobsRequest(h, http.MethodGet, "/jobs"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("scheduler not started: got %d, want 503", w.Code)
+	}
+
+	app.RunJob()
+	defer app.StopJob()
+	app.USER_STORE.Store("jobs-api", app.UserCredentials{Username: "jobs-api", Password: "p"})
+	defer app.USER_STORE.Delete("jobs-api")
+
+	var morning app.JobInfo
+	for _, j := range listedJobs(t, h) {
+		if j.Kind == app.JobKindRoutine && j.Name == app.RoutineMorning {
+			morning = j
+		}
+	}
+	if morning.ID == 0 || morning.State != app.JobStateScheduled || morning.NextRun.IsZero() {
+		t.Fatalf("morning routine not listed: %+v", morning)
+	}
+	routinePath := fmt.Sprintf("/jobs/%d", morning.ID)
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodDelete, "/jobs/abc", http.StatusBadRequest},
+		{http.MethodDelete, "/jobs/999999", http.StatusNotFound},
+		{http.MethodPost, "/jobs/999999/run-now", http.StatusNotFound},
+		{http.MethodDelete, routinePath, http.StatusConflict},
+	} {
+		if w := jobsRequest(h, tc.method, tc.path); w.Code != tc.want {
+			t.Errorf("%s %s: got %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+
+	// Chạy ngay routine sáng để có job một lần của user
+	if w := jobsRequest(h, http.MethodPost, routinePath+"/run-now"); w.Code != http.StatusAccepted {
+		t.Fatalf("run-now routine: got %d", w.Code)
+	}
+	var job app.JobInfo
+	for deadline := time.Now().Add(2 * time.Second); job.ID == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, j := range listedJobs(t, h) {
+			if j.Kind == app.JobKindOneTime && j.Username == "jobs-api" && j.Action == "CHECKIN" {
+				job = j
+			}
+		}
+	}
+	if job.ID == 0 {
+		t.Fatal("morning routine did not schedule a one-time job")
+	}
+	jobPath := fmt.Sprintf("/jobs/%d", job.ID)
+
+	// Dry-run chỉ áp dụng cho job một lần và không đổi lịch chạy thật
+	if w := jobsRequest(h, http.MethodPost, routinePath+"/run-now?dryRun=true"); w.Code != http.StatusConflict {
+		t.Errorf("dry-run routine: got %d, want 409", w.Code)
+	}
+	if w := jobsRequest(h, http.MethodPost, jobPath+"/run-now?dryRun=true"); w.Code != http.StatusAccepted {
+		t.Errorf("dry-run one-time job: got %d, want 202", w.Code)
+	}
+	if j := findJob(t, h, job.ID); j.State != app.JobStateScheduled {
+		t.Errorf("dry-run should keep the job scheduled, got %+v", j)
+	}
+
+	if w := jobsRequest(h, http.MethodDelete, jobPath); w.Code != http.StatusNoContent {
+		t.Errorf("cancel one-time job: got %d", w.Code)
+	}
+	if w := jobsRequest(h, http.MethodDelete, jobPath); w.Code != http.StatusNotFound {
+		t.Errorf("cancel twice: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-ngsc-erp/internal/elog"
+
+	"github.com/go-chi/render"
+)
+
+const sseHeartbeat = 15 * time.Second
+const sseBuffer = 100
+
+// logFilter lọc log theo level tối thiểu và user, lấy từ query ?level=&user=
+type logFilter struct {
+	level elog.Level
+	user  string
+}
+
+func parseLogFilter(r *http.Request) (logFilter, error) {
+	f := logFilter{level: elog.LevelDebug, user: r.URL.Query().Get("user")}
+	if lv := r.URL.Query().Get("level"); lv != "" {
+		level, ok := elog.LookupLevel(lv)
+		if !ok {
+			return f, fmt.Errorf("invalid level %q", lv)
+		}
+		f.level = level
+	}
+	return f, nil
+}
+
+func (f logFilter) match(e elog.Entry) bool {
+	if e.Level < f.level {
+		return false
+	}
+	if f.user != "" {
+		if user, _ := e.Fields["user"].(string); user != f.user {
+			return false
+		}
+	}
+	return true
+}
+
+// listLogs trả về các log gần nhất còn trong bộ nhớ, ?limit= giới hạn số log mới nhất
+func listLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", l), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries := make([]map[string]interface{}, 0)
+	for _, e := range elog.Recent() {
+		if filter.match(e) {
+			entries = append(entries, e.Map())
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	render.JSON(w, r, entries)
+}
+
+// streamLogs đẩy log mới qua Server-Sent Events để theo dõi trực tiếp trên trình duyệt
+func streamLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	entries, unsubscribe := elog.Subscribe(sseBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e := <-entries:
+			if !filter.match(e) {
+				continue
+			}
+			b, err := json.Marshal(e.Map())
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/internal/elog"
+)
+
+func TestListLogs(t *testing.T) {
+	// User riêng cho mỗi lần chạy, ring buffer còn giữ log của lần chạy trước (-count)
+	user := "logs-" + elog.NewID()
+	elog.Info("logs test info", elog.F("user", user))
+	elog.Warn("logs test warn", elog.F("user", user))
+	elog.Warn("logs test other user", elog.F("user", "logs-other"))
+
+	w := httptest.NewRecorder()
+	listLogs(w, httptest.NewRequest(http.MethodGet, "/admin/logs?level=warn&user="+user, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0]["msg"] != "logs test warn" || entries[0]["user"] != user {
+		t.Errorf("filtered logs = %v, want only the warning of %s", entries, user)
+	}
+
+	w = httptest.NewRecorder()
+	listLogs(w, httptest.NewRequest(http.MethodGet, "/admin/logs?limit=1&user="+user, nil))
+	entries = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0]["msg"] != "logs test warn" {
+		t.Errorf("limit=1 should keep the newest entry, got %v, %v", entries, err)
+	}
+
+	for _, query := range []string{"level=verbose", "limit=-1", "limit=x"} {
+		w = httptest.NewRecorder()
+		listLogs(w, httptest.NewRequest(http.MethodGet, "/admin/logs?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestStreamLogs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(streamLogs))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?user=stream-a", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d %q, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Header đã được gửi nên handler đã đăng ký nhận log
+	elog.Info("stream test other user", elog.F("user", "stream-b"))
+	elog.Info("stream test", elog.F("user", "stream-a"))
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]interface{}
+	if !strings.HasPrefix(line, "data: ") || json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &entry) != nil {
+		t.Fatalf("got %q, want an sse data line", line)
+	}
+	if entry["msg"] != "stream test" || entry["user"] != "stream-a" {
+		t.Errorf("got %v, want only the entry of stream-a", entry)
+	}
+}
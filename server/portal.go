@@ -0,0 +1,411 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/erp/login"
+	"html/template"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var portalTemplates = template.Must(template.New("portal").Funcs(template.FuncMap{
+	"fmtTime": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.In(app.Location).Format("02/01/2006 15:04")
+	},
+}).ParseFS(templateFS, "templates/*.html"))
+
+const (
+	portalCookie = "ngsc_portal"
+	// Số dòng lịch sử và số ngày xem trước lịch hiển thị trên trang chính
+	portalHistorySize = 20
+	portalWindowDays  = 3
+)
+
+// Thông báo sau khi redirect, chỉ nhận key cố định để không hiển thị nội dung tùy ý từ query string
+var portalMessages = map[string]string{
+	"password": "Đã lưu mật khẩu mới.",
+	"paused":   "Đã tạm dừng tự động chấm công.",
+	"resumed":  "Đã bật lại tự động chấm công.",
+	"queued":   "Đã xếp hàng chấm công, kết quả sẽ có trong lịch sử sau ít phút.",
+}
+
+type portalSession struct {
+	Username string
+	CSRF     string
+	Expires  time.Time
+}
+
+// portalSessions lưu phiên đăng nhập portal theo token trong cookie, mất khi restart
+var portalSessions sync.Map
+
+// sweepPortalSessions xóa các phiên đã hết hạn, được gọi mỗi lần đăng nhập để phiên không bị đăng xuất
+// (đóng trình duyệt) không nằm mãi trong bộ nhớ
+func sweepPortalSessions(now time.Time) {
+	portalSessions.Range(func(key, value interface{}) bool {
+		if !now.Before(value.(portalSession).Expires) {
+			portalSessions.Delete(key)
+		}
+		return true
+	})
+}
+
+type portalSessionKey struct{}
+
+type loginPage struct {
+	Username string
+	Error    string
+}
+
+type dashboardPage struct {
+	User       app.UserCredentials
+	CSRF       string
+	Message    string
+	Error      string
+	Credential *app.CredentialState
+	Jobs       []app.JobInfo
+	JobsNote   string
+	Windows    []app.ScheduleWindow
+	WindowDays int
+	History    []app.CsvAttendanceLog
+}
+
+// portalRoutes trả về router của trang tự phục vụ, được mount tại /portal
+func portalRoutes(cfg config.PortalConfig) http.Handler {
+	r := chi.NewRouter()
+	throttle := newLoginThrottle(time.Duration(cfg.LoginWindowMinutes) * time.Minute)
+	// portal.trustedProxies đã được config.Validate kiểm tra
+	proxies, _ := cfg.ParseTrustedProxies()
+	r.Get("/login", func(w http.ResponseWriter, r *http.Request) {
+		renderPortal(w, "login.html", loginPage{})
+	})
+	r.Post("/login", portalLogin(cfg, throttle, proxies))
+	r.Group(func(r chi.Router) {
+		r.Use(portalAuth)
+		r.Get("/", portalDashboard)
+		r.Post("/logout", portalLogout)
+		r.Post("/password", portalPassword(cfg, throttle))
+		r.Post("/pause", portalPause)
+		r.Post("/action", portalAction)
+	})
+	return r
+}
+
+func renderPortal(w http.ResponseWriter, name string, data interface{}) {
+	renderPortalStatus(w, http.StatusOK, name, data)
+}
+
+func renderPortalStatus(w http.ResponseWriter, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := portalTemplates.ExecuteTemplate(w, name, data); err != nil {
+		elog.Error("error rendering portal page", elog.Fields{"page": name, "err": err})
+	}
+}
+
+func newPortalToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// portalAuth tìm phiên từ cookie, chuyển về trang đăng nhập nếu chưa đăng nhập hoặc hết hạn.
+// Mọi request POST phải mang csrf_token của phiên.
+func portalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(portalCookie)
+		if err != nil {
+			http.Redirect(w, r, "/portal/login", http.StatusSeeOther)
+			return
+		}
+		v, ok := portalSessions.Load(cookie.Value)
+		if !ok || v.(portalSession).Expires.Before(time.Now()) {
+			portalSessions.Delete(cookie.Value)
+			http.Redirect(w, r, "/portal/login", http.StatusSeeOther)
+			return
+		}
+		session := v.(portalSession)
+		if _, ok := app.USER_STORE.Load(session.Username); !ok {
+			portalSessions.Delete(cookie.Value)
+			http.Redirect(w, r, "/portal/login", http.StatusSeeOther)
+			return
+		}
+		if r.Method == http.MethodPost && subtle.ConstantTimeCompare([]byte(r.FormValue("csrf_token")), []byte(session.CSRF)) != 1 {
+			http.Error(w, "invalid csrf token", http.StatusForbidden)
+			return
+		}
+		logger := elog.FromContext(r.Context()).With(elog.Fields{"user": session.Username, "portal": true})
+		ctx := context.WithValue(elog.NewContext(r.Context(), logger), portalSessionKey{}, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func currentPortalSession(r *http.Request) portalSession {
+	return r.Context().Value(portalSessionKey{}).(portalSession)
+}
+
+func currentPortalUser(r *http.Request) (app.UserCredentials, bool) {
+	v, ok := app.USER_STORE.Load(currentPortalSession(r).Username)
+	if !ok {
+		return app.UserCredentials{}, false
+	}
+	return v.(app.UserCredentials), true
+}
+
+// verifyERPLogin thử đăng nhập ERP bằng mật khẩu (và secret TOTP) cho user, theo instance của user
+func verifyERPLogin(ctx context.Context, user app.UserCredentials, password, totpSecret string) error {
+	if _, err := erp.LookupInstance(user.Instance); err != nil {
+		return err
+	}
+	ctx = login.WithTOTPSecret(erp.WithInstance(ctx, user.Instance), totpSecret)
+	return login.DoLogin(ctx, user.Username, password)
+}
+
+// loginRejected cho biết ERP đã từ chối lần đăng nhập, lần thử này được tính vào giới hạn của loginThrottle
+func loginRejected(err error) bool {
+	return errors.Is(err, login.ErrInvalidCredentials) || errors.Is(err, login.ErrTOTPInvalid) ||
+		errors.Is(err, login.ErrTOTPRequired) || errors.Is(err, login.ErrAccountLocked)
+}
+
+// loginErrorMessage chuyển lỗi đăng nhập ERP thành thông báo cho người dùng, không lộ chi tiết nội bộ
+func loginErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, login.ErrAccountLocked):
+		return "Tài khoản ERP đang bị khóa tạm thời, hãy thử lại sau."
+	case loginRejected(err):
+		return "Sai tài khoản hoặc mật khẩu ERP."
+	case errors.Is(err, login.ErrTOTPUnsupported):
+		return "Tài khoản bật xác thực hai lớp chưa được hỗ trợ trên ERP này, hãy báo quản trị viên."
+	}
+	return "Không kết nối được ERP, hãy thử lại sau."
+}
+
+func throttledMessage(cfg config.PortalConfig) string {
+	return fmt.Sprintf("Đăng nhập sai quá nhiều lần, hãy thử lại sau %d phút.", cfg.LoginWindowMinutes)
+}
+
+// portalLogin xác thực bằng chính tài khoản ERP: user phải có trong USER_STORE và ERP chấp nhận mật khẩu.
+// Số lần thử bị giới hạn theo username và IP trước khi gọi ERP, tránh dùng portal để khóa tài khoản ERP của người khác.
+func portalLogin(cfg config.PortalConfig, throttle *loginThrottle, proxies []netip.Prefix) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.FormValue("username")
+		password := r.FormValue("password")
+		logger := elog.FromContext(r.Context())
+		ip := clientIP(r, proxies)
+		ipLimit := throttleLimit{key: "ip:" + ip, max: cfg.MaxFailuresPerIP}
+		userLimit := throttleLimit{key: "user:" + username, max: cfg.MaxFailuresPerUser}
+		v, ok := app.USER_STORE.Load(username)
+		if !ok || password == "" {
+			// Vẫn tính lượt theo IP để không dò được danh sách user
+			status := http.StatusOK
+			message := "Sai tài khoản hoặc mật khẩu ERP."
+			if !throttle.acquire(time.Now(), ipLimit) {
+				status, message = http.StatusTooManyRequests, throttledMessage(cfg)
+			}
+			logger.Warn("portal login for unknown user", elog.F("user", username))
+			renderPortalStatus(w, status, "login.html", loginPage{Username: username, Error: message})
+			return
+		}
+		if !throttle.acquire(time.Now(), userLimit, ipLimit) {
+			logger.Warn("portal login throttled", elog.Fields{"user": username, "ip": ip})
+			renderPortalStatus(w, http.StatusTooManyRequests, "login.html", loginPage{Username: username, Error: throttledMessage(cfg)})
+			return
+		}
+		user := v.(app.UserCredentials)
+		err := verifyERPLogin(r.Context(), user, password, user.TOTPSecret)
+		if !loginRejected(err) {
+			throttle.refund(userLimit.key, ipLimit.key)
+		}
+		if err != nil {
+			logger.Warn("portal login rejected", elog.Fields{"user": username, "err": err})
+			renderPortal(w, "login.html", loginPage{Username: username, Error: loginErrorMessage(err)})
+			return
+		}
+
+		now := time.Now()
+		sweepPortalSessions(now)
+		token := newPortalToken()
+		expires := now.Add(time.Duration(cfg.SessionMinutes) * time.Minute)
+		portalSessions.Store(token, portalSession{Username: username, CSRF: newPortalToken(), Expires: expires})
+		http.SetCookie(w, &http.Cookie{
+			Name:     portalCookie,
+			Value:    token,
+			Path:     "/portal",
+			Expires:  expires,
+			HttpOnly: true,
+			Secure:   cfg.SecureCookie,
+			SameSite: http.SameSiteLaxMode,
+		})
+		logger.Info("portal login", elog.F("user", username))
+		http.Redirect(w, r, "/portal/", http.StatusSeeOther)
+	}
+}
+
+func portalLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(portalCookie); err == nil {
+		portalSessions.Delete(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: portalCookie, Value: "", Path: "/portal", MaxAge: -1})
+	http.Redirect(w, r, "/portal/login", http.StatusSeeOther)
+}
+
+func portalDashboard(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentPortalUser(r)
+	if !ok {
+		http.Redirect(w, r, "/portal/login", http.StatusSeeOther)
+		return
+	}
+	page := dashboardPage{
+		User:       user,
+		CSRF:       currentPortalSession(r).CSRF,
+		Message:    portalMessages[r.URL.Query().Get("msg")],
+		WindowDays: portalWindowDays,
+	}
+	if state, ok := app.CredentialStateFor(user.Username); ok {
+		page.Credential = &state
+	}
+
+	jobs, err := app.ListJobs()
+	switch {
+	case errors.Is(err, app.ErrSchedulerNotStarted):
+		page.JobsNote = "Lịch chạy ở một replica khác, danh sách job không có ở đây."
+	case err != nil:
+		page.JobsNote = "Không đọc được danh sách job."
+	}
+	for _, j := range jobs {
+		if j.Kind == app.JobKindOneTime && j.Username == user.Username {
+			page.Jobs = append(page.Jobs, j)
+		}
+	}
+	now := time.Now()
+	page.Windows, _ = app.PreviewSchedule(app.PreviewOptions{From: now, To: now.AddDate(0, 0, portalWindowDays), Username: user.Username})
+
+	logs, err := app.ReadCSVAndMap()
+	if err != nil {
+		elog.FromContext(r.Context()).Debug("no attendance history", elog.F("err", err))
+	}
+	for _, l := range logs {
+		if l.Username == user.Username {
+			page.History = append(page.History, l)
+		}
+	}
+	sort.SliceStable(page.History, func(i, j int) bool { return page.History[i].ActionTime.After(page.History[j].ActionTime) })
+	if len(page.History) > portalHistorySize {
+		page.History = page.History[:portalHistorySize]
+	}
+	renderPortal(w, "dashboard.html", page)
+}
+
+// renderDashboardError hiển thị lại trang chính kèm thông báo lỗi
+func renderDashboardError(w http.ResponseWriter, r *http.Request, message string) {
+	user, _ := currentPortalUser(r)
+	renderPortal(w, "dashboard.html", dashboardPage{User: user, CSRF: currentPortalSession(r).CSRF, Error: message, WindowDays: portalWindowDays})
+}
+
+// portalPassword thử đăng nhập ERP bằng mật khẩu mới, chỉ lưu khi ERP chấp nhận.
+// Lần thử dùng chung giới hạn theo username với portalLogin.
+func portalPassword(cfg config.PortalConfig, throttle *loginThrottle) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentPortalUser(r)
+		if !ok {
+			http.Redirect(w, r, "/portal/login", http.StatusSeeOther)
+			return
+		}
+		password := r.FormValue("password")
+		totpSecret := r.FormValue("totp_secret")
+		if password == "" {
+			renderDashboardError(w, r, "Hãy nhập mật khẩu mới.")
+			return
+		}
+		if totpSecret != "" {
+			if _, err := login.TOTPCode(totpSecret, time.Now()); err != nil {
+				renderDashboardError(w, r, "Secret TOTP không hợp lệ.")
+				return
+			}
+		}
+		secret := user.TOTPSecret
+		if totpSecret != "" {
+			secret = totpSecret
+		}
+		userLimit := throttleLimit{key: "user:" + user.Username, max: cfg.MaxFailuresPerUser}
+		if !throttle.acquire(time.Now(), userLimit) {
+			renderDashboardError(w, r, throttledMessage(cfg))
+			return
+		}
+		err := verifyERPLogin(r.Context(), user, password, secret)
+		if !loginRejected(err) {
+			throttle.refund(userLimit.key)
+		}
+		if err != nil {
+			elog.FromContext(r.Context()).Warn("new password rejected by erp", elog.F("err", err))
+			renderDashboardError(w, r, loginErrorMessage(err))
+			return
+		}
+		if err := app.UpdateCredentials(user.Username, password, totpSecret); err != nil {
+			elog.FromContext(r.Context()).Error("could not save credentials", elog.F("err", err))
+			renderDashboardError(w, r, "Không lưu được mật khẩu, hãy báo quản trị viên.")
+			return
+		}
+		http.Redirect(w, r, "/portal/?msg=password", http.StatusSeeOther)
+	}
+}
+
+func portalPause(w http.ResponseWriter, r *http.Request) {
+	paused, err := strconv.ParseBool(r.FormValue("paused"))
+	if err != nil {
+		http.Error(w, "invalid paused value", http.StatusBadRequest)
+		return
+	}
+	username := currentPortalSession(r).Username
+	if err := app.SetPaused(username, paused); err != nil {
+		elog.FromContext(r.Context()).Error("could not change pause", elog.F("err", err))
+		renderDashboardError(w, r, "Không đổi được trạng thái tạm dừng, hãy báo quản trị viên.")
+		return
+	}
+	msg := "resumed"
+	if paused {
+		msg = "paused"
+	}
+	http.Redirect(w, r, "/portal/?msg="+msg, http.StatusSeeOther)
+}
+
+// portalAction chấm công tay qua worker pool; action chạy cả khi user đang tạm dừng.
+// Request có thể kết thúc trước action nên action dùng context riêng, chỉ giữ logger của request.
+func portalAction(w http.ResponseWriter, r *http.Request) {
+	logger := elog.FromContext(r.Context())
+	_, err := app.RunUserAction(elog.NewContext(context.Background(), logger), currentPortalSession(r).Username, r.FormValue("action"))
+	switch {
+	case err == nil:
+		logger.Info("manual action queued from portal", elog.F("action", r.FormValue("action")))
+		http.Redirect(w, r, "/portal/?msg=queued", http.StatusSeeOther)
+	case errors.Is(err, app.ErrActionQueueFull):
+		renderDashboardError(w, r, "Hệ thống đang bận, hãy thử lại sau ít phút.")
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
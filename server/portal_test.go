@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/erp/login"
+	"go-ngsc-erp/internal/config"
+)
+
+const portalTestUser = "portal@ngs.com.vn"
+
+// fakeERP giả lập /web/session/authenticate của Odoo, chấp nhận portalTestUser với mật khẩu hiện tại trên ERP
+type fakeERP struct {
+	password atomic.Value
+	requests atomic.Int32
+}
+
+func startFakeERP(t *testing.T, password string) *fakeERP {
+	f := &fakeERP{}
+	f.password.Store(password)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.requests.Add(1)
+		var req login.AuthenticateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if req.Params.Login != portalTestUser || req.Params.Password != f.password.Load().(string) {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":200,"message":"Odoo Server Error","data":{"name":"odoo.exceptions.AccessDenied","message":"Access Denied"}}}`))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "sid-portal", Path: "/", MaxAge: 3600})
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"uid":7000,"db":"ngsc"}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := config.Default().ERP
+	cfg.BaseURL = srv.URL + "/web"
+	cfg.LoginMethod = config.LoginMethodJSONRPC
+	cfg.Database = "ngsc"
+	cfg.RequestsPerSecond = 0
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = erp.Configure(config.Default().ERP)
+		login.LOGIN_SESSION.Delete(portalTestUser)
+	})
+	return f
+}
+
+func testPortal(t *testing.T) http.Handler {
+	app.USER_STORE.Store(portalTestUser, app.UserCredentials{Username: portalTestUser, Password: "stored"})
+	t.Cleanup(func() { app.USER_STORE.Delete(portalTestUser) })
+	return portalRoutes(config.Default().Portal)
+}
+
+func newSession(t *testing.T, expires time.Time) string {
+	token := newPortalToken()
+	portalSessions.Store(token, portalSession{Username: portalTestUser, CSRF: "csrf-" + token, Expires: expires})
+	t.Cleanup(func() { portalSessions.Delete(token) })
+	return token
+}
+
+func portalRequest(h http.Handler, method, path, token string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: portalCookie, Value: token})
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestPortalAuth(t *testing.T) {
+	h := testPortal(t)
+
+	if w := portalRequest(h, http.MethodGet, "/", "", nil); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/portal/login" {
+		t.Errorf("no cookie: got %d %q, want redirect to login", w.Code, w.Header().Get("Location"))
+	}
+
+	expired := newSession(t, time.Now().Add(-time.Minute))
+	if w := portalRequest(h, http.MethodGet, "/", expired, nil); w.Code != http.StatusSeeOther {
+		t.Errorf("expired session: got %d, want redirect", w.Code)
+	}
+	if _, ok := portalSessions.Load(expired); ok {
+		t.Error("expired session should be deleted")
+	}
+
+	token := newSession(t, time.Now().Add(time.Hour))
+	form := url.Values{"paused": {"true"}}
+	if w := portalRequest(h, http.MethodPost, "/pause", token, form); w.Code != http.StatusForbidden {
+		t.Errorf("missing csrf token: got %d, want 403", w.Code)
+	}
+	form.Set("csrf_token", "wrong")
+	if w := portalRequest(h, http.MethodPost, "/pause", token, form); w.Code != http.StatusForbidden {
+		t.Errorf("bad csrf token: got %d, want 403", w.Code)
+	}
+	if v, _ := app.USER_STORE.Load(portalTestUser); v.(app.UserCredentials).Paused {
+		t.Fatal("rejected request must not pause the user")
+	}
+
+	form.Set("csrf_token", "csrf-"+token)
+	if w := portalRequest(h, http.MethodPost, "/pause", token, form); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/portal/?msg=paused" {
+		t.Errorf("pause: got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if v, _ := app.USER_STORE.Load(portalTestUser); !v.(app.UserCredentials).Paused {
+		t.Error("user should be paused")
+	}
+	form.Set("paused", "false")
+	if w := portalRequest(h, http.MethodPost, "/pause", token, form); w.Header().Get("Location") != "/portal/?msg=resumed" {
+		t.Errorf("resume: got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if v, _ := app.USER_STORE.Load(portalTestUser); v.(app.UserCredentials).Paused {
+		t.Error("user should be resumed")
+	}
+
+	if w := portalRequest(h, http.MethodGet, "/", token, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), portalTestUser) {
+		t.Errorf("dashboard: got %d", w.Code)
+	}
+}
+
+func TestPortalPassword(t *testing.T) {
+	f := startFakeERP(t, "rotated")
+	h := testPortal(t)
+	token := newSession(t, time.Now().Add(time.Hour))
+	form := url.Values{"csrf_token": {"csrf-" + token}, "password": {"guess"}}
+	if state, err := app.CheckCredentials(context.Background(), portalTestUser); err != nil || !state.Suppressed {
+		t.Fatalf("stale stored password should suspend the user, got %+v, %v", state, err)
+	}
+
+	w := portalRequest(h, http.MethodPost, "/password", token, form)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Sai tài khoản hoặc mật khẩu ERP.") {
+		t.Errorf("rejected password: got %d, want the dashboard with an error", w.Code)
+	}
+	if v, _ := app.USER_STORE.Load(portalTestUser); v.(app.UserCredentials).Password != "stored" {
+		t.Fatal("password rejected by the ERP must not be saved")
+	}
+
+	form.Set("password", "rotated")
+	w = portalRequest(h, http.MethodPost, "/password", token, form)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/portal/?msg=password" {
+		t.Errorf("accepted password: got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if v, _ := app.USER_STORE.Load(portalTestUser); v.(app.UserCredentials).Password != "rotated" {
+		t.Error("password accepted by the ERP should be saved")
+	}
+	if state, ok := app.CredentialStateFor(portalTestUser); ok && state.Suppressed {
+		t.Errorf("saving an accepted password should resume scheduled actions, got %+v", state)
+	}
+	if got := f.requests.Load(); got != 3 {
+		t.Errorf("erp received %d logins, want 3", got)
+	}
+}
+
+func TestPortalLoginThrottle(t *testing.T) {
+	f := startFakeERP(t, "secret")
+	h := testPortal(t)
+
+	w := portalRequest(h, http.MethodPost, "/login", "", url.Values{"username": {portalTestUser}, "password": {"secret"}})
+	if w.Code != http.StatusSeeOther || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("login: got %d, want a session cookie", w.Code)
+	}
+	portalSessions.Delete(w.Result().Cookies()[0].Value)
+
+	// Đăng nhập thành công dọn các phiên đã hết hạn
+	expired := newSession(t, time.Now().Add(-time.Minute))
+	w = portalRequest(h, http.MethodPost, "/login", "", url.Values{"username": {portalTestUser}, "password": {"secret"}})
+	portalSessions.Delete(w.Result().Cookies()[0].Value)
+	if _, ok := portalSessions.Load(expired); ok {
+		t.Error("expired sessions should be swept on login")
+	}
+
+	max := config.Default().Portal.MaxFailuresPerUser
+	for i := 0; i < max+2; i++ {
+		w = portalRequest(h, http.MethodPost, "/login", "", url.Values{"username": {portalTestUser}, "password": {"wrong"}})
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("repeated failures: got %d, want 429", w.Code)
+	}
+	if got := f.requests.Load(); got != int32(2+max) {
+		t.Errorf("erp received %d logins, want %d", got, 2+max)
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"go-ngsc-erp/erp/app"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+// Số ngày xem trước mặc định khi không truyền to
+const defaultPreviewDays = 7
+
+// previewSchedule trả về các khoảng thời gian sẽ chấm công trong [from, to).
+// from/to nhận YYYY-MM-DD (theo timezone của scheduler, to tính hết ngày) hoặc RFC3339;
+// morningCron/eveningCron cho phép thử cron mới trước khi gọi POST /cron.
+func previewSchedule(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from := time.Now().In(app.Location)
+	if v := q.Get("from"); v != "" {
+		t, err := parsePreviewTime(v, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	to := from.AddDate(0, 0, defaultPreviewDays)
+	if v := q.Get("to"); v != "" {
+		t, err := parsePreviewTime(v, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	windows, err := app.PreviewSchedule(app.PreviewOptions{
+		From:        from,
+		To:          to,
+		Username:    q.Get("user"),
+		MorningCron: q.Get("morningCron"),
+		EveningCron: q.Get("eveningCron"),
+	})
+	switch {
+	case errors.Is(err, app.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	render.JSON(w, r, windows)
+}
+
+func parsePreviewTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, v, app.Location); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use YYYY-MM-DD or RFC3339", v)
+	}
+	return t, nil
+}
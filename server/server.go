@@ -1,81 +1,155 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"go-ngsc-erp/erp"
 	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/erp/login"
 	"net/http"
 
+	"go-ngsc-erp/internal/config"
 	"go-ngsc-erp/internal/elog"
+	"go-ngsc-erp/internal/metrics"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 )
 
-func StartServer() {
+// requestLogger gắn logger mang request_id của middleware.RequestID vào context của request
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := elog.With(elog.F("request_id", middleware.GetReqID(r.Context())))
+		next.ServeHTTP(w, r.WithContext(elog.NewContext(r.Context(), logger)))
+	})
+}
+
+// invalidUsers cho biết lỗi của AddUsers là do dữ liệu user gửi lên (400) chứ không phải lỗi ghi file (500)
+func invalidUsers(err error) bool {
+	return errors.Is(err, erp.ErrUnknownInstance) || errors.Is(err, login.ErrTOTPUnsupported) || errors.Is(err, login.ErrInvalidTOTPSecret)
+}
+
+// uploadUsers thêm hoặc thay user trong USER_STORE. Khi có store.usersFile, user được ghi vào file để reload không xóa mất
+func uploadUsers(w http.ResponseWriter, r *http.Request) {
+	var userCredentials []app.UserCredentials
+	err := render.Decode(r, &userCredentials)
+	if err != nil {
+		elog.FromContext(r.Context()).Warn("invalid upload payload", elog.F("err", err))
+		// Trả về lỗi 400 Bad Request nếu JSON không hợp lệ
+		http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := app.AddUsers(userCredentials); err != nil {
+		if invalidUsers(err) {
+			http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+			return
+		}
+		elog.FromContext(r.Context()).Error("could not save users", elog.F("err", err))
+		http.Error(w, fmt.Sprintf("Could not save users: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, user := range userCredentials {
+		elog.FromContext(r.Context()).Info("added user", elog.Fields{"user": user.Username})
+	}
+}
+
+// listUsers trả về danh sách user đã ẩn mật khẩu, secret TOTP và webhook của chủ tài khoản
+func listUsers(w http.ResponseWriter, r *http.Request) {
+	userResponse := make([]app.UserCredentials, 0)
+	app.USER_STORE.Range(func(key, value interface{}) bool {
+		userResponse = append(userResponse, value.(app.UserCredentials).Redact().(app.UserCredentials))
+		return true
+	})
+	render.JSON(w, r, userResponse)
+}
+
+func StartServer(cfg config.Config) {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(requestLogger)
 
-	r.Post("/upload", func(w http.ResponseWriter, r *http.Request) {
-		var userCredentials []app.UserCredentials
-		err := render.Decode(r, &userCredentials)
+	r.Post("/upload", uploadUsers)
+	r.Get("/users", listUsers)
+
+	r.Get("/users/identity", listIdentities)
+	r.Post("/users/{name}/discover", discoverIdentity)
+	r.Get("/users/credentials", listCredentials)
+	r.Post("/users/{name}/credentials/check", checkCredentials)
+	r.Put("/users/{name}/credentials", updateCredentials)
+
+	r.Post("/cron", func(w http.ResponseWriter, r *http.Request) {
+		var cron CronnJobConfig
+		err := render.Decode(r, &cron)
 		if err != nil {
-			elog.Warn("invalid upload payload", elog.F("err", err))
+			elog.FromContext(r.Context()).Warn("invalid cron payload", elog.F("err", err))
 			// Trả về lỗi 400 Bad Request nếu JSON không hợp lệ
 			http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
 			return
 		}
-		for _, user := range userCredentials {
-			app.USER_STORE.Store(user.Username, user)
-			elog.Info("added user", elog.Fields{"user": user.Username})
-			fmt.Printf("added user %v \n", user)
+		err = app.RescheduleRoutines(cron.DailyMorningCron, cron.DailyEveningCron)
+		if err != nil {
+			elog.FromContext(r.Context()).Warn("invalid cron payload", elog.F("err", err))
+			http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+			return
 		}
 	})
 
-	r.Get("/users", func(w http.ResponseWriter, r *http.Request) {
-		userResponse := make([]app.UserCredentials, 0)
-		app.USER_STORE.Range(func(key, value interface{}) bool {
-			userResponse = append(userResponse, value.(app.UserCredentials))
-			return true
-		})
-		render.JSON(w, r, userResponse)
-	})
+	r.Get("/schedule/preview", previewSchedule)
 
-	r.Post("/cron", func(w http.ResponseWriter, r *http.Request) {
-		var cron CronnJobConfig
-		err := render.Decode(r, &cron)
+	r.Get("/statistic", func(w http.ResponseWriter, r *http.Request) {
+		result, err := app.ReadCSVAndMap()
 		if err != nil {
-			elog.Warn("invalid cron payload", elog.F("err", err))
+			elog.FromContext(r.Context()).Warn("error reading statistics", elog.F("err", err))
 			// Trả về lỗi 400 Bad Request nếu JSON không hợp lệ
 			http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
 			return
 		}
-		if cron.DailyMorningCron == "" {
-			app.DailyMorningCron = cron.DailyMorningCron
-		}
-		if cron.DailyEveningCron != "" {
-			app.DailyEveningCron = cron.DailyEveningCron
+		render.JSON(w, r, result)
+	})
+
+	if cfg.Portal.Enabled {
+		if !cfg.Portal.SecureCookie {
+			elog.Warn("portal is enabled without portal.secureCookie, serve it only over https", nil)
 		}
+		r.Mount("/portal", portalRoutes(cfg.Portal))
+	}
+
+	r.Handle("/metrics", metrics.Handler())
+	r.Get("/healthz", healthz)
+	r.Get("/readyz", readyz)
+
+	r.Get("/jobs", listJobs)
+	r.Delete("/jobs/{id}", cancelJob)
+	r.Post("/jobs/{id}/run-now", runJobNow)
 
+	r.Get("/config", func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, app.CurrentConfig().Redacted())
 	})
 
-	r.Get("/statistic", func(w http.ResponseWriter, r *http.Request) {
-		result, err := app.ReadCSVAndMap()
+	r.Post("/admin/reload", func(w http.ResponseWriter, r *http.Request) {
+		result, err := app.Reload(app.ReloadSourceAPI)
 		if err != nil {
-			elog.Warn("error reading statistics", elog.F("err", err))
-			// Trả về lỗi 400 Bad Request nếu JSON không hợp lệ
-			http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Reload failed: %v", err), http.StatusBadRequest)
 			return
 		}
 		render.JSON(w, r, result)
 	})
 
-	elog.Info("starting server", elog.F("addr", ":8080"))
-	err := http.ListenAndServe(":8080", r)
+	r.Get("/admin/logs", listLogs)
+	r.Get("/admin/logs/stream", streamLogs)
+	r.Get("/admin/log-level", getLogLevel)
+	r.Put("/admin/log-level", putLogLevel)
+	r.Put("/admin/log-level/users/{name}", putLogLevelOverride(elog.OverrideUser))
+	r.Delete("/admin/log-level/users/{name}", deleteLogLevelOverride(elog.OverrideUser))
+	r.Put("/admin/log-level/packages/{name}", putLogLevelOverride(elog.OverridePackage))
+	r.Delete("/admin/log-level/packages/{name}", deleteLogLevelOverride(elog.OverridePackage))
+
+	elog.Info("starting server", elog.F("addr", cfg.Server.Addr))
+	err := http.ListenAndServe(cfg.Server.Addr, r)
 	if err != nil {
 		elog.Fatal("server exited", elog.F("err", err))
 	}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Số key tối đa trước khi dọn các key đã hết cửa sổ
+const throttlePruneSize = 1024
+
+// loginThrottle giới hạn số lần thử đăng nhập ERP từ portal theo key (user:<tên>, ip:<địa chỉ>) trong một cửa sổ cố định.
+// Lượt được tính trước khi gọi ERP để các request song song không vượt giới hạn; lần thử thành công được trả lại.
+type loginThrottle struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]throttleEntry
+}
+
+type throttleEntry struct {
+	count int
+	reset time.Time
+}
+
+type throttleLimit struct {
+	key string
+	max int
+}
+
+func newLoginThrottle(window time.Duration) *loginThrottle {
+	return &loginThrottle{window: window, entries: make(map[string]throttleEntry)}
+}
+
+// acquire tính một lần thử cho mọi key, trả về false và không tính gì nếu một key đã hết lượt
+func (t *loginThrottle) acquire(now time.Time, limits ...throttleLimit) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, l := range limits {
+		if e, ok := t.entries[l.key]; ok && now.Before(e.reset) && e.count >= l.max {
+			return false
+		}
+	}
+	if len(t.entries) >= throttlePruneSize {
+		for k, e := range t.entries {
+			if !now.Before(e.reset) {
+				delete(t.entries, k)
+			}
+		}
+	}
+	for _, l := range limits {
+		e, ok := t.entries[l.key]
+		if !ok || !now.Before(e.reset) {
+			e = throttleEntry{reset: now.Add(t.window)}
+		}
+		e.count++
+		t.entries[l.key] = e
+	}
+	return true
+}
+
+// refund trả lại lượt đã tính cho các key, dùng khi lần thử không bị ERP từ chối
+func (t *loginThrottle) refund(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, k := range keys {
+		if e, ok := t.entries[k]; ok && e.count > 0 {
+			e.count--
+			t.entries[k] = e
+		}
+	}
+}
+
+// clientIP trả về địa chỉ của client để giới hạn theo IP. Header X-Forwarded-For/X-Real-IP do client tự đặt được
+// nên chỉ được dùng khi kết nối đến từ một proxy trong trusted; khi đó lấy địa chỉ phải nhất không thuộc proxy.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trustedProxy(host, trusted) {
+		return host
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			if !trustedProxy(hop, trusted) || i == 0 {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return host
+}
+
+func trustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
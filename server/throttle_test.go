@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := newLoginThrottle(time.Minute)
+	now := time.Now()
+	user := throttleLimit{key: "user:a", max: 2}
+	ip := throttleLimit{key: "ip:10.0.0.1", max: 3}
+
+	for i := 0; i < 2; i++ {
+		if !throttle.acquire(now, user, ip) {
+			t.Fatalf("attempt %d should be allowed", i+1)
+		}
+	}
+	if throttle.acquire(now, user, ip) {
+		t.Fatal("third attempt for the same user should be throttled")
+	}
+	// Lần bị chặn không tính vào IP, IP còn một lượt cho user khác
+	if !throttle.acquire(now, throttleLimit{key: "user:b", max: 2}, ip) {
+		t.Fatal("another user from the same ip should still be allowed")
+	}
+	if throttle.acquire(now, throttleLimit{key: "user:c", max: 2}, ip) {
+		t.Fatal("ip limit should apply across users")
+	}
+
+	throttle.refund(user.key)
+	if !throttle.acquire(now, user) {
+		t.Fatal("refunded attempt should be available again")
+	}
+	if !throttle.acquire(now.Add(time.Minute), user, ip) {
+		t.Fatal("limits should reset after the window")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name, remote, xff, realIP, want string
+	}{
+		{"direct client cannot spoof", "203.0.113.7:5000", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"proxy forwards client", "10.0.0.5:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed hops left of the proxy are ignored", "10.0.0.5:5000", "192.0.2.9, 198.51.100.1, 10.0.0.4", "", "198.51.100.1"},
+		{"real ip from proxy", "10.0.0.5:5000", "", "198.51.100.3", "198.51.100.3"},
+		{"proxy without headers", "10.0.0.5:5000", "", "", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/login", nil)
+		r.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := clientIP(r, proxies); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got := clientIP(httptest.NewRequest("POST", "/login", nil), nil); got != "192.0.2.1" {
+		t.Errorf("no trusted proxies: got %s, want the connection address", got)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-ngsc-erp/erp"
+	"go-ngsc-erp/erp/app"
+	"go-ngsc-erp/internal/config"
+	"go-ngsc-erp/internal/elog"
+)
+
+func TestUploadAndListUsers(t *testing.T) {
+	cfg := config.Default().ERP
+	cfg.Instances = []config.ERPInstance{{Name: "rpc", LoginMethod: config.LoginMethodJSONRPC, Database: "ngsc"}}
+	if err := erp.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = erp.Configure(config.Default().ERP) }()
+	defer app.USER_STORE.Delete("upload@ngs.com.vn")
+
+	upload := func(body string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		uploadUsers(w, r)
+		if w.Code == http.StatusBadRequest && !strings.Contains(w.Body.String(), "bad@ngs.com.vn") {
+			t.Errorf("400 should name the rejected user, got %q", w.Body.String())
+		}
+		return w.Code
+	}
+	for name, body := range map[string]string{
+		"unknown instance":  `[{"username":"bad@ngs.com.vn","password":"p","instance":"nope"}]`,
+		"bad totp secret":   `[{"username":"bad@ngs.com.vn","password":"p","totpSecret":"not base32!"}]`,
+		"totp with jsonrpc": `[{"username":"bad@ngs.com.vn","password":"p","instance":"rpc","totpSecret":"JBSWY3DPEHPK3PXP"}]`,
+	} {
+		if code := upload(body); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", name, code)
+		}
+	}
+	if _, ok := app.USER_STORE.Load("bad@ngs.com.vn"); ok {
+		t.Fatal("rejected users must not be stored")
+	}
+
+	if code := upload(`[{"username":"upload@ngs.com.vn","password":"secret","totpSecret":"JBSWY3DPEHPK3PXP","notifyWebhook":"https://hooks.example.com/t0ken"}]`); code != http.StatusOK {
+		t.Fatalf("valid upload: got %d", code)
+	}
+	w := httptest.NewRecorder()
+	listUsers(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	var users []app.UserCredentials
+	if err := json.Unmarshal(w.Body.Bytes(), &users); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range users {
+		if u.Username != "upload@ngs.com.vn" {
+			continue
+		}
+		if u.Password != elog.RedactedValue || u.TOTPSecret != elog.RedactedValue || u.NotifyWebhook != elog.RedactedValue {
+			t.Errorf("secrets must be redacted, got %+v", u)
+		}
+		return
+	}
+	t.Errorf("uploaded user missing from %s", w.Body.String())
+}